@@ -8,32 +8,144 @@ import (
 )
 
 type Config struct {
-	SentinelBackends         []string
-	ProxyPort                int
-	HealthCheckInterval      time.Duration
-	IntegrityCheckInterval   time.Duration
-	IntegrityCheckEpochs     int
-	RequestTimeout           time.Duration
-	LogLevel                 string
-	SlotsPerEpoch            int
-	ArchiverThresholdEpochs  int
-	ExpectedValidators       int
-	IntegrityScoreThreshold  int
+	SentinelBackends           []string
+	ProxyPort                  int
+	HealthCheckInterval        time.Duration
+	HealthFailureThreshold     int
+	HealthSuccessThreshold     int
+	HealthUnhealthyInterval    time.Duration
+	HealthMaxBackoff           time.Duration
+	HealthCheckJitterPercent   int
+	IntegrityCheckInterval     time.Duration
+	IntegrityCheckEpochs       int
+	RequestTimeout             time.Duration
+	LogLevel                   string
+	MetricsMaxMethods          int
+	SlotsPerEpoch              int
+	ArchiverThresholdEpochs    int
+	ExpectedValidators         int
+	IntegrityScoreThreshold    int
+	MaxBatchSize               int
+	MaxBlockLag                int
+	RetryMaxAttempts           int
+	RetryBudgetPercent         int // Retries as a percentage of requests: 0 disables retries, negative leaves them unbounded
+	RetryBackoff               time.Duration
+	RetryBackoffMax            time.Duration
+	RetryExcludedMethods       []string
+	RPCBackendErrorCodes       []int
+	RPCRetryableErrorCodes     []int
+	HedgeEnabled               bool
+	HedgeDelay                 time.Duration
+	HedgePercentile            int
+	HedgeMethods               []string
+	CoalesceEnabled            bool
+	CoalesceMethods            []string
+	CacheEnabled               bool
+	CacheMaxBytes              int
+	CacheShortTTL              time.Duration
+	CacheFinality              string
+	TipsPollInterval           time.Duration
+	SessionEnabled             bool
+	SessionHeader              string
+	SessionCookie              string
+	SessionAPIKeyHeader        string
+	SessionTTL                 time.Duration
+	SessionMaxEntries          int
+	CapabilityProbeInterval    time.Duration
+	CapabilityProbeMethods     []string
+	VersionPolicy              string
+	VersionPin                 string
+	LBStrategy                 string
+	LBStrategyArchiver         string
+	LBStrategyPruned           string
+	LBEWMADecay                time.Duration
+	SlowStartWindow            time.Duration
+	SlowStartCurve             string
+	SlowStartMinWeightPercent  int
+	BreakerConsecutiveFailures int
+	BreakerErrorRatePercent    int
+	BreakerWindow              int
+	BreakerOpenTime            time.Duration
+	BreakerHalfOpenRequests    int
+	OutlierInterval            time.Duration
+	OutlierLatencyFactor       int
+	OutlierErrorRatePercent    int
+	OutlierMinRequests         int
+	OutlierMinHosts            int
+	OutlierBaseEjection        time.Duration
+	OutlierMaxEjection         time.Duration
+	OutlierMaxEjectedPercent   int
 }
 
 func Load() *Config {
 	return &Config{
-		SentinelBackends:        parseStringSlice(getEnv("SENTINEL_BACKENDS", "")),
-		ProxyPort:               parseInt(getEnv("PROXY_PORT", "8080")),
-		HealthCheckInterval:     parseDurationMs(getEnv("HEALTH_CHECK_INTERVAL_MS", "30000")),
-		IntegrityCheckInterval:  parseDurationMs(getEnv("INTEGRITY_CHECK_INTERVAL_MS", "60000")),
-		IntegrityCheckEpochs:    parseInt(getEnv("INTEGRITY_CHECK_EPOCHS", "10")),
-		RequestTimeout:          parseDurationMs(getEnv("REQUEST_TIMEOUT_MS", "30000")),
-		LogLevel:                getEnv("LOG_LEVEL", "info"),
-		SlotsPerEpoch:           parseInt(getEnv("SLOTS_PER_EPOCH", "32")),
-		ArchiverThresholdEpochs: parseInt(getEnv("ARCHIVER_THRESHOLD_EPOCHS", "100")),
-		ExpectedValidators:      parseInt(getEnv("EXPECTED_VALIDATORS", "24")),
-		IntegrityScoreThreshold: parseInt(getEnv("INTEGRITY_SCORE_THRESHOLD", "95")),
+		SentinelBackends:           parseStringSlice(getEnv("SENTINEL_BACKENDS", "")),
+		ProxyPort:                  parseInt(getEnv("PROXY_PORT", "8080")),
+		HealthCheckInterval:        parseDurationMs(getEnv("HEALTH_CHECK_INTERVAL_MS", "30000")),
+		HealthFailureThreshold:     parseInt(getEnv("HEALTH_FAILURE_THRESHOLD", "3")),
+		HealthSuccessThreshold:     parseInt(getEnv("HEALTH_SUCCESS_THRESHOLD", "2")),
+		HealthUnhealthyInterval:    parseDurationMs(getEnv("HEALTH_UNHEALTHY_INTERVAL_MS", "5000")),
+		HealthMaxBackoff:           parseDurationMs(getEnv("HEALTH_MAX_BACKOFF_MS", "300000")),
+		HealthCheckJitterPercent:   parseInt(getEnv("HEALTH_CHECK_JITTER_PERCENT", "10")),
+		IntegrityCheckInterval:     parseDurationMs(getEnv("INTEGRITY_CHECK_INTERVAL_MS", "60000")),
+		IntegrityCheckEpochs:       parseInt(getEnv("INTEGRITY_CHECK_EPOCHS", "10")),
+		RequestTimeout:             parseDurationMs(getEnv("REQUEST_TIMEOUT_MS", "30000")),
+		LogLevel:                   getEnv("LOG_LEVEL", "info"),
+		MetricsMaxMethods:          parseInt(getEnv("METRICS_MAX_METHODS", "100")),
+		SlotsPerEpoch:              parseInt(getEnv("SLOTS_PER_EPOCH", "32")),
+		ArchiverThresholdEpochs:    parseInt(getEnv("ARCHIVER_THRESHOLD_EPOCHS", "100")),
+		ExpectedValidators:         parseInt(getEnv("EXPECTED_VALIDATORS", "24")),
+		IntegrityScoreThreshold:    parseInt(getEnv("INTEGRITY_SCORE_THRESHOLD", "95")),
+		MaxBatchSize:               parseInt(getEnv("MAX_BATCH_SIZE", "100")),
+		MaxBlockLag:                parseInt(getEnv("MAX_BLOCK_LAG", "5")),
+		RetryMaxAttempts:           parseInt(getEnv("RETRY_MAX_ATTEMPTS", "3")),
+		RetryBudgetPercent:         parseInt(getEnv("RETRY_BUDGET_PERCENT", "20")),
+		RetryBackoff:               parseDurationMs(getEnv("RETRY_BACKOFF_MS", "50")),
+		RetryBackoffMax:            parseDurationMs(getEnv("RETRY_BACKOFF_MAX_MS", "1000")),
+		RetryExcludedMethods:       parseStringSlice(getEnv("RETRY_EXCLUDED_METHODS", "node_sendTx")),
+		RPCBackendErrorCodes:       parseIntSlice(getEnv("RPC_BACKEND_ERROR_CODES", "-32603")),
+		RPCRetryableErrorCodes:     parseIntSlice(getEnv("RPC_RETRYABLE_ERROR_CODES", "-32002,-32005")),
+		HedgeEnabled:               parseBool(getEnv("HEDGE_ENABLED", "false")),
+		HedgeDelay:                 parseDurationMs(getEnv("HEDGE_DELAY_MS", "250")),
+		HedgePercentile:            parseInt(getEnv("HEDGE_PERCENTILE", "95")),
+		HedgeMethods:               parseStringSlice(getEnv("HEDGE_METHODS", "node_getBlock,node_getBlocks,node_getBlockHeader,node_getBlockNumber,node_getProvenBlockNumber,node_getL2Tips,node_getTxReceipt,node_getTxEffect,node_getPublicLogs,node_getContractClassLogs")),
+		CoalesceEnabled:            parseBool(getEnv("COALESCE_ENABLED", "true")),
+		CoalesceMethods:            parseStringSlice(getEnv("COALESCE_METHODS", "node_getBlock,node_getBlocks,node_getBlockHeader,node_getBlockNumber,node_getProvenBlockNumber,node_getL2Tips,node_getTxReceipt,node_getTxEffect,node_getPublicLogs,node_getContractClassLogs")),
+		CacheEnabled:               parseBool(getEnv("CACHE_ENABLED", "true")),
+		CacheMaxBytes:              parseInt(getEnv("CACHE_MAX_BYTES", "33554432")),
+		CacheShortTTL:              parseDurationMs(getEnv("CACHE_SHORT_TTL_MS", "1000")),
+		CacheFinality:              getEnv("CACHE_FINALITY", "finalized"),
+		TipsPollInterval:           parseDurationMs(getEnv("TIPS_POLL_INTERVAL_MS", "5000")),
+		SessionEnabled:             parseBool(getEnv("SESSION_ENABLED", "false")),
+		SessionHeader:              getEnv("SESSION_HEADER", "X-Sentinel-Session"),
+		SessionCookie:              getEnv("SESSION_COOKIE", "sentinel_session"),
+		SessionAPIKeyHeader:        getEnv("SESSION_API_KEY_HEADER", "X-Api-Key"),
+		SessionTTL:                 parseDurationMs(getEnv("SESSION_TTL_MS", "600000")),
+		SessionMaxEntries:          parseInt(getEnv("SESSION_MAX_ENTRIES", "100000")),
+		CapabilityProbeInterval:    parseDurationMs(getEnv("CAPABILITY_PROBE_INTERVAL_MS", "300000")),
+		CapabilityProbeMethods:     parseStringSlice(getEnv("CAPABILITY_PROBE_METHODS", "node_getValidatorsStats,node_getValidatorStats,node_getL2Tips,node_getPublicLogs,node_getContractClassLogs")),
+		VersionPolicy:              getEnv("VERSION_POLICY", "any"),
+		VersionPin:                 getEnv("VERSION_PIN", ""),
+		LBStrategy:                 getEnv("LB_STRATEGY", "weighted"),
+		LBStrategyArchiver:         getEnv("LB_STRATEGY_ARCHIVER", ""),
+		LBStrategyPruned:           getEnv("LB_STRATEGY_PRUNED", ""),
+		LBEWMADecay:                parseDurationMs(getEnv("LB_EWMA_DECAY_MS", "10000")),
+		SlowStartWindow:            parseDurationMs(getEnv("SLOW_START_MS", "0")),
+		SlowStartCurve:             getEnv("SLOW_START_CURVE", "linear"),
+		SlowStartMinWeightPercent:  parseInt(getEnv("SLOW_START_MIN_WEIGHT_PERCENT", "10")),
+		BreakerConsecutiveFailures: parseInt(getEnv("BREAKER_CONSECUTIVE_FAILURES", "5")),
+		BreakerErrorRatePercent:    parseInt(getEnv("BREAKER_ERROR_RATE_PERCENT", "50")),
+		BreakerWindow:              parseInt(getEnv("BREAKER_WINDOW", "20")),
+		BreakerOpenTime:            parseDurationMs(getEnv("BREAKER_OPEN_MS", "30000")),
+		BreakerHalfOpenRequests:    parseInt(getEnv("BREAKER_HALF_OPEN_REQUESTS", "3")),
+		OutlierInterval:            parseDurationMs(getEnv("OUTLIER_INTERVAL_MS", "10000")),
+		OutlierLatencyFactor:       parseInt(getEnv("OUTLIER_LATENCY_FACTOR", "3")),
+		OutlierErrorRatePercent:    parseInt(getEnv("OUTLIER_ERROR_RATE_PERCENT", "20")),
+		OutlierMinRequests:         parseInt(getEnv("OUTLIER_MIN_REQUESTS", "20")),
+		OutlierMinHosts:            parseInt(getEnv("OUTLIER_MIN_HOSTS", "3")),
+		OutlierBaseEjection:        parseDurationMs(getEnv("OUTLIER_BASE_EJECTION_MS", "30000")),
+		OutlierMaxEjection:         parseDurationMs(getEnv("OUTLIER_MAX_EJECTION_MS", "300000")),
+		OutlierMaxEjectedPercent:   parseInt(getEnv("OUTLIER_MAX_EJECTED_PERCENT", "30")),
 	}
 }
 
@@ -49,6 +161,11 @@ func parseInt(s string) int {
 	return v
 }
 
+func parseBool(s string) bool {
+	v, _ := strconv.ParseBool(s)
+	return v
+}
+
 func parseDurationMs(s string) time.Duration {
 	ms, _ := strconv.Atoi(s)
 	return time.Duration(ms) * time.Millisecond
@@ -67,3 +184,13 @@ func parseStringSlice(s string) []string {
 	}
 	return result
 }
+
+func parseIntSlice(s string) []int {
+	var result []int
+	for _, p := range parseStringSlice(s) {
+		if v, err := strconv.Atoi(p); err == nil {
+			result = append(result, v)
+		}
+	}
+	return result
+}
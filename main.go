@@ -10,6 +10,7 @@ import (
 
 	"github.com/DashNode-Org/sentinel-proxy/config"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/health"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/lifecycle"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/server"
@@ -27,6 +28,7 @@ func main() {
 
 	// Register metrics
 	metrics.Register()
+	metrics.SetMaxMethods(cfg.MetricsMaxMethods)
 
 	// Setup logging
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -47,14 +49,18 @@ func main() {
 	// Initialize Load Balancer and Health Checkers
 	lb := proxy.NewLoadBalancer(cfg)
 
-	hc := health.NewChecker(cfg, lb)
-	go hc.Start()
-
-	ic := health.NewIntegrityChecker(cfg, lb)
-	go ic.Start()
+	// Background components run until the supervisor is stopped on shutdown
+	sup := lifecycle.NewSupervisor(context.Background())
+	sup.Start(health.NewChecker(cfg, lb))
+	sup.Start(health.NewIntegrityChecker(cfg, lb))
+	sup.Start(health.NewCapabilityProber(cfg, lb))
+	sup.Start(health.NewOutlierDetector(cfg, lb))
 
 	forwarder := proxy.NewRequestForwarder(cfg, lb)
 
+	// Tips drive finality-aware cache invalidation, so start after the forwarder subscribes
+	sup.Start(health.NewTipsTracker(cfg, lb))
+
 	// Initialize and Start Server
 	srv := server.NewServer(cfg, lb, forwarder)
 
@@ -77,5 +83,9 @@ func main() {
 		log.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
 
+	if err := sup.Stop(ctx); err != nil {
+		log.Fatal().Err(err).Msg("Background components did not stop in time")
+	}
+
 	log.Info().Msg("Server exited properly")
 }
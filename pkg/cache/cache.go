@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+)
+
+// Cache stores serialized responses by key. Implementations must be safe for
+// concurrent use; a ttl of 0 means the entry never expires.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+	Len() int
+}
+
+// EvictNotifier is implemented by caches that report entries leaving them, so
+// callers can keep side indexes of cached keys bounded.
+type EvictNotifier interface {
+	// OnEvict registers fn to be called with the key of every entry that
+	// expires, is evicted or is deleted. fn runs with the cache locked and
+	// must not call back into it.
+	OnEvict(fn func(key string))
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time // Zero for entries without a time limit
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// Memory is an in-process LRU cache bounded by the total size of its entries.
+type Memory struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+	onEvict  func(key string)
+}
+
+func NewMemory(maxBytes int64) *Memory {
+	return &Memory{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		m.remove(el, "expired")
+		return nil, false
+	}
+	m.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) {
+	e := &entry{key: key, value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e.size() > m.maxBytes {
+		// Too large to store; the entry it replaces is stale either way
+		if el, ok := m.items[key]; ok {
+			m.remove(el, "invalidated")
+		}
+		return
+	}
+
+	if el, ok := m.items[key]; ok {
+		m.size -= el.Value.(*entry).size()
+		el.Value = e
+		m.ll.MoveToFront(el)
+	} else {
+		m.items[key] = m.ll.PushFront(e)
+	}
+	m.size += e.size()
+
+	for m.size > m.maxBytes {
+		m.remove(m.ll.Back(), "capacity")
+	}
+	metrics.SetCacheSize(m.size)
+}
+
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.remove(el, "invalidated")
+	}
+}
+
+func (m *Memory) OnEvict(fn func(key string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEvict = fn
+}
+
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len()
+}
+
+// remove drops an element and records why. Caller holds m.mu.
+func (m *Memory) remove(el *list.Element, reason string) {
+	e := el.Value.(*entry)
+	m.ll.Remove(el)
+	delete(m.items, e.key)
+	m.size -= e.size()
+	metrics.RecordCacheEviction(reason)
+	metrics.SetCacheSize(m.size)
+	if m.onEvict != nil {
+		m.onEvict(e.key)
+	}
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory_EvictsLeastRecentlyUsed(t *testing.T) {
+	// Each entry is 1 byte of key + 9 bytes of value
+	c := NewMemory(30)
+	value := []byte("123456789")
+
+	c.Set("a", value, 0)
+	c.Set("b", value, 0)
+	c.Set("c", value, 0)
+
+	// Touch "a" so "b" becomes the oldest
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	c.Set("d", value, 0)
+
+	_, ok = c.Get("b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+	for _, k := range []string{"a", "c", "d"} {
+		_, ok := c.Get(k)
+		assert.True(t, ok, k)
+	}
+	assert.Equal(t, 3, c.Len())
+}
+
+func TestMemory_Expiry(t *testing.T) {
+	c := NewMemory(1024)
+	c.Set("short", []byte("v"), 10*time.Millisecond)
+	c.Set("forever", []byte("v"), 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok := c.Get("short")
+	assert.False(t, ok)
+	_, ok = c.Get("forever")
+	assert.True(t, ok)
+}
+
+func TestMemory_ReplaceAndDelete(t *testing.T) {
+	c := NewMemory(1024)
+	c.Set("k", []byte("old"), 0)
+	c.Set("k", []byte("new"), 0)
+
+	v, ok := c.Get("k")
+	assert.True(t, ok)
+	assert.Equal(t, "new", string(v))
+	assert.Equal(t, 1, c.Len())
+
+	c.Delete("k")
+	_, ok = c.Get("k")
+	assert.False(t, ok)
+}
+
+func TestMemory_RejectsOversizedValues(t *testing.T) {
+	c := NewMemory(4)
+	c.Set("k", []byte("too large"), 0)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestMemory_OversizedValueDropsPreviousEntry(t *testing.T) {
+	c := NewMemory(16)
+	c.Set("k", []byte("old"), 0)
+	c.Set("k", []byte("new value too large"), 0)
+
+	_, ok := c.Get("k")
+	assert.False(t, ok, "the older response must not be served")
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestMemory_OnEvict(t *testing.T) {
+	c := NewMemory(16)
+	var evicted []string
+	c.OnEvict(func(key string) { evicted = append(evicted, key) })
+
+	c.Set("a", []byte("1234567"), 0)
+	c.Set("a", []byte("123"), 0) // Replacing is not evicting
+	c.Set("b", []byte("1234567"), time.Millisecond)
+	c.Set("c", []byte("1234567"), 0) // Pushes out "a"
+	time.Sleep(2 * time.Millisecond)
+	c.Get("b")
+	c.Delete("c")
+
+	assert.Equal(t, []string{"a", "b", "c"}, evicted)
+}
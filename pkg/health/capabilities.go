@@ -0,0 +1,123 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/lifecycle"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
+	"github.com/rs/zerolog/log"
+)
+
+// CapabilityProber periodically records the node and protocol version of each
+// backend and which of the probed methods it does not serve.
+type CapabilityProber struct {
+	cfg           *config.Config
+	lb            *proxy.LoadBalancer
+	clientFactory func(url string, timeout time.Duration) rpc.RPCClient
+}
+
+func NewCapabilityProber(cfg *config.Config, lb *proxy.LoadBalancer) *CapabilityProber {
+	return &CapabilityProber{
+		cfg: cfg,
+		lb:  lb,
+		clientFactory: func(url string, timeout time.Duration) rpc.RPCClient {
+			return rpc.NewClient(url, timeout)
+		},
+	}
+}
+
+// WithClientFactory allows injecting a mock factory for testing
+func (p *CapabilityProber) WithClientFactory(f func(url string, timeout time.Duration) rpc.RPCClient) *CapabilityProber {
+	p.clientFactory = f
+	return p
+}
+
+func (p *CapabilityProber) Name() string { return "capabilities" }
+
+// Run probes every CapabilityProbeInterval until ctx is cancelled.
+func (p *CapabilityProber) Run(ctx context.Context) {
+	lifecycle.Every(ctx, p.cfg.CapabilityProbeInterval, p.ProbeAll)
+}
+
+// ProbeAll probes every healthy backend in parallel.
+func (p *CapabilityProber) ProbeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range p.lb.Snapshot().Backends {
+		if !b.Healthy {
+			continue
+		}
+		wg.Add(1)
+		go func(url string, known map[string]bool) {
+			defer wg.Done()
+			p.probe(ctx, url, known)
+		}(b.URL, b.UnsupportedMethods)
+	}
+	wg.Wait()
+}
+
+// probe calls each configured method without params, plus every method
+// already marked unsupported so upgraded nodes get them back. Only a "method
+// not found" answer marks a method unsupported; invalid params or a result
+// mean the method exists, and transport errors keep the previous state.
+func (p *CapabilityProber) probe(ctx context.Context, url string, known map[string]bool) {
+	client := p.clientFactory(url, p.cfg.RequestTimeout)
+
+	nodeVersion, err := client.GetNodeVersion(ctx)
+	if err != nil {
+		log.Debug().Err(err).Str("url", url).Msg("Failed to fetch node version")
+	}
+	protocolVersion, err := client.GetProtocolVersion(ctx)
+	if err != nil {
+		log.Debug().Err(err).Str("url", url).Msg("Failed to fetch protocol version")
+	}
+
+	methods := make(map[string]bool)
+	for _, m := range p.cfg.CapabilityProbeMethods {
+		methods[m] = true
+	}
+	for m := range known {
+		methods[m] = true
+	}
+
+	unsupported := make(map[string]bool)
+	for m := range methods {
+		_, err := client.Call(ctx, m)
+		switch {
+		case rpc.IsMethodNotFound(err):
+			unsupported[m] = true
+		case err != nil && !isRPCError(err) && known[m]:
+			unsupported[m] = true // Unreachable, keep the previous verdict
+		}
+	}
+
+	if ctx.Err() != nil {
+		return // Shutting down, the results are incomplete
+	}
+
+	p.lb.UpdateBackendStateByUrl(url, func(b *proxy.Backend) {
+		if nodeVersion != "" {
+			if b.NodeVersion != "" && b.NodeVersion != nodeVersion {
+				log.Info().Str("url", url).Str("from", b.NodeVersion).Str("to", nodeVersion).Msg("Backend node version changed")
+			}
+			b.NodeVersion = nodeVersion
+		}
+		if protocolVersion != 0 {
+			b.ProtocolVersion = protocolVersion
+		}
+		b.SetUnsupportedMethods(unsupported)
+	})
+
+	log.Debug().Str("url", url).Str("nodeVersion", nodeVersion).Int("protocolVersion", protocolVersion).Int("unsupported", len(unsupported)).Msg("Capability probe completed")
+}
+
+// isRPCError reports whether err is a JSON-RPC error returned by the node,
+// as opposed to a transport failure.
+func isRPCError(err error) bool {
+	var rpcErr *rpc.JSONRPCError
+	return errors.As(err, &rpcErr)
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCapabilityProber_RecordsVersionsAndMethods(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends:       []string{"http://node1"},
+		CapabilityProbeMethods: []string{"node_getValidatorsStats", "node_getPublicLogs"},
+	}
+	lb := proxy.NewLoadBalancer(cfg)
+
+	client := new(MockClient)
+	client.On("GetNodeVersion", mock.Anything).Return("1.2.0", nil)
+	client.On("GetProtocolVersion", mock.Anything).Return(7, nil)
+	client.On("Call", mock.Anything, "node_getValidatorsStats").Return(nil, &rpc.JSONRPCError{Code: rpc.CodeMethodNotFound, Message: "Method not found"})
+	client.On("Call", mock.Anything, "node_getPublicLogs").Return(nil, &rpc.JSONRPCError{Code: -32602, Message: "Invalid params"})
+
+	p := NewCapabilityProber(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return client
+	})
+	p.ProbeAll(context.Background())
+
+	b := lb.Snapshot().Backends[0]
+	assert.Equal(t, "1.2.0", b.NodeVersion)
+	assert.Equal(t, 7, b.ProtocolVersion)
+	assert.Equal(t, map[string]bool{"node_getValidatorsStats": true}, b.UnsupportedMethods)
+	assert.Nil(t, lb.Select(proxy.Criteria{Method: "node_getValidatorsStats"}))
+	assert.NotNil(t, lb.Select(proxy.Criteria{Method: "node_getPublicLogs"}))
+}
+
+func TestCapabilityProber_RechecksUnsupportedMethods(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://node1"}}
+	lb := proxy.NewLoadBalancer(cfg)
+	lb.MarkMethodUnsupported(lb.Snapshot().Backends[0], "node_getL2Tips")
+
+	client := new(MockClient)
+	client.On("GetNodeVersion", mock.Anything).Return("", errors.New("timeout"))
+	client.On("GetProtocolVersion", mock.Anything).Return(0, errors.New("timeout"))
+	client.On("Call", mock.Anything, "node_getL2Tips").Return(json.RawMessage(`{}`), nil)
+
+	p := NewCapabilityProber(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return client
+	})
+	p.ProbeAll(context.Background())
+
+	assert.Empty(t, lb.Snapshot().Backends[0].UnsupportedMethods, "a node that serves the method again gets it back")
+}
@@ -2,61 +2,154 @@ package health
 
 import (
 	"context"
+	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/lifecycle"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
 	"github.com/rs/zerolog/log"
 )
 
+// fastRechecks is the number of failed checks run at the unhealthy interval
+// before rechecks of a dead backend back off exponentially.
+const fastRechecks = 5
+
+// Checker runs readiness checks on every backend, each on its own schedule:
+// the regular interval while healthy, the shorter unhealthy interval while a
+// backend is failing or recovering, and an exponential backoff once it has
+// stayed dead for a while. Every interval is jittered so checks of different
+// backends do not line up.
 type Checker struct {
-	cfg *config.Config
-	lb  *proxy.LoadBalancer
+	cfg           *config.Config
+	lb            *proxy.LoadBalancer
+	clientFactory func(url string, timeout time.Duration) rpc.RPCClient
 }
 
 func NewChecker(cfg *config.Config, lb *proxy.LoadBalancer) *Checker {
-	return &Checker{cfg: cfg, lb: lb}
+	return &Checker{
+		cfg: cfg,
+		lb:  lb,
+		clientFactory: func(url string, timeout time.Duration) rpc.RPCClient {
+			return rpc.NewClient(url, timeout)
+		},
+	}
+}
+
+// WithClientFactory allows injecting a mock factory for testing
+func (c *Checker) WithClientFactory(f func(url string, timeout time.Duration) rpc.RPCClient) *Checker {
+	c.clientFactory = f
+	return c
+}
+
+func (c *Checker) Name() string { return "health" }
+
+// Run checks every backend on its own schedule until ctx is cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range c.lb.Snapshot().Backends {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			c.run(ctx, url)
+		}(b.URL)
+	}
+	wg.Wait()
 }
 
-func (c *Checker) Start() {
-	go func() {
-		ticker := time.NewTicker(c.cfg.HealthCheckInterval)
-		for range ticker.C {
-			c.CheckAll()
+// run checks one backend immediately and then on its adaptive schedule.
+func (c *Checker) run(ctx context.Context, url string) {
+	failures := 0
+	for {
+		passed, healthy := c.checkBackend(ctx, url)
+		if passed {
+			failures = 0
+		} else {
+			failures++
+		}
+		if !lifecycle.Sleep(ctx, c.jitter(c.nextInterval(healthy, failures))) {
+			return
 		}
-	}()
-	c.CheckAll() // Run immediately
+	}
+}
+
+// CheckAll checks every backend once in parallel.
+func (c *Checker) CheckAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range c.lb.Snapshot().Backends {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			c.checkBackend(ctx, url)
+		}(b.URL)
+	}
+	wg.Wait()
+}
+
+// nextInterval returns the unjittered delay before the next check of a
+// backend, given whether it is currently considered healthy and how many
+// checks in a row it has failed.
+func (c *Checker) nextInterval(healthy bool, failures int) time.Duration {
+	fast := c.cfg.HealthUnhealthyInterval
+	if fast <= 0 || fast > c.cfg.HealthCheckInterval {
+		fast = c.cfg.HealthCheckInterval
+	}
+
+	switch {
+	case healthy && failures == 0:
+		return c.cfg.HealthCheckInterval
+	case failures <= fastRechecks:
+		// Confirm a suspected failure or a recovery quickly
+		return fast
+	}
+
+	d := fast
+	for i := fastRechecks; i < failures && d < c.cfg.HealthMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, max(c.cfg.HealthMaxBackoff, fast))
 }
 
-func (c *Checker) CheckAll() {
-	backends := c.lb.GetBackends()
-	for _, b := range backends {
-		go c.checkBackend(b.URL)
+// jitter spreads d by up to HealthCheckJitterPercent in either direction.
+func (c *Checker) jitter(d time.Duration) time.Duration {
+	if c.cfg.HealthCheckJitterPercent <= 0 {
+		return d
 	}
+	spread := float64(d) * float64(c.cfg.HealthCheckJitterPercent) / 100
+	return d + time.Duration((rand.Float64()*2-1)*spread)
 }
 
-func (c *Checker) checkBackend(url string) {
+// checkBackend runs one readiness check and reports whether it passed and
+// whether the backend is considered healthy afterwards. A check cut short by
+// shutdown is not held against the backend.
+func (c *Checker) checkBackend(ctx context.Context, url string) (bool, bool) {
 	start := time.Now()
-	client := rpc.NewClient(url, c.cfg.RequestTimeout)
+	client := c.clientFactory(url, c.cfg.RequestTimeout)
 
 	// Check Readiness
-	isReady, err := client.IsReady(context.Background())
+	isReady, err := client.IsReady(ctx)
+	if ctx.Err() != nil {
+		return false, false
+	}
 	if err != nil || !isReady {
-		c.lb.UpdateBackendHealth(url, false, 0, time.Since(start))
-		return
+		log.Debug().Err(err).Str("url", url).Msg("Health check failed: not ready")
+		return false, c.lb.UpdateBackendHealth(url, false, 0, time.Since(start))
 	}
 
 	// Get Block Number
-	blockNum, err := client.GetBlockNumber(context.Background())
+	blockNum, err := client.GetBlockNumber(ctx)
+	if ctx.Err() != nil {
+		return false, false
+	}
 	if err != nil {
-		c.lb.UpdateBackendHealth(url, false, 0, time.Since(start))
-		return
+		log.Debug().Err(err).Str("url", url).Msg("Health check failed: block number")
+		return false, c.lb.UpdateBackendHealth(url, false, 0, time.Since(start))
 	}
 
 	// Success
-	c.lb.UpdateBackendHealth(url, true, blockNum, time.Since(start))
+	healthy := c.lb.UpdateBackendHealth(url, true, blockNum, time.Since(start))
 	log.Debug().Str("url", url).Int("block", blockNum).Dur("latency", time.Since(start)).Msg("Health check passed")
+	return true, healthy
 }
-
-
@@ -0,0 +1,252 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/lifecycle"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChecker_Hysteresis(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends:       []string{"http://node1"},
+		HealthFailureThreshold: 2,
+		HealthSuccessThreshold: 2,
+	}
+	lb := proxy.NewLoadBalancer(cfg)
+
+	client := new(MockClient)
+	client.On("IsReady", mock.Anything).Return(false, errors.New("connection refused")).Times(2)
+	client.On("IsReady", mock.Anything).Return(true, nil)
+	client.On("GetBlockNumber", mock.Anything).Return(42, nil)
+
+	c := NewChecker(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return client
+	})
+
+	c.CheckAll(context.Background())
+	assert.True(t, lb.Snapshot().Backends[0].Healthy, "one failure is not enough")
+	c.CheckAll(context.Background())
+	assert.False(t, lb.Snapshot().Backends[0].Healthy)
+	c.CheckAll(context.Background())
+	assert.False(t, lb.Snapshot().Backends[0].Healthy, "one pass is not enough")
+	c.CheckAll(context.Background())
+	assert.True(t, lb.Snapshot().Backends[0].Healthy)
+	assert.Equal(t, 42, lb.Snapshot().Backends[0].BlockNumber)
+}
+
+func TestChecker_NextInterval(t *testing.T) {
+	cfg := &config.Config{
+		HealthCheckInterval:     30 * time.Second,
+		HealthUnhealthyInterval: 5 * time.Second,
+		HealthMaxBackoff:        60 * time.Second,
+	}
+	c := NewChecker(cfg, proxy.NewLoadBalancer(cfg))
+
+	assert.Equal(t, 30*time.Second, c.nextInterval(true, 0))
+	assert.Equal(t, 5*time.Second, c.nextInterval(true, 1), "suspected failures are confirmed quickly")
+	assert.Equal(t, 5*time.Second, c.nextInterval(false, 0), "recoveries are confirmed quickly")
+	assert.Equal(t, 5*time.Second, c.nextInterval(false, fastRechecks))
+	assert.Equal(t, 10*time.Second, c.nextInterval(false, fastRechecks+1))
+	assert.Equal(t, 20*time.Second, c.nextInterval(false, fastRechecks+2))
+	assert.Equal(t, 60*time.Second, c.nextInterval(false, fastRechecks+4), "backoff is capped")
+	assert.Equal(t, 60*time.Second, c.nextInterval(false, 1000))
+
+	cfg.HealthMaxBackoff = 0
+	assert.Equal(t, 5*time.Second, c.nextInterval(false, 1000), "no backoff without a cap")
+}
+
+func TestChecker_Jitter(t *testing.T) {
+	cfg := &config.Config{HealthCheckJitterPercent: 10}
+	c := NewChecker(cfg, proxy.NewLoadBalancer(cfg))
+
+	for i := 0; i < 100; i++ {
+		d := c.jitter(10 * time.Second)
+		assert.GreaterOrEqual(t, d, 9*time.Second)
+		assert.LessOrEqual(t, d, 11*time.Second)
+	}
+
+	cfg.HealthCheckJitterPercent = 0
+	assert.Equal(t, 10*time.Second, c.jitter(10*time.Second))
+}
+
+func TestChecker_StopsWithSupervisor(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends:    []string{"http://node1", "http://node2"},
+		HealthCheckInterval: time.Millisecond,
+	}
+	lb := proxy.NewLoadBalancer(cfg)
+
+	client := new(MockClient)
+	client.On("IsReady", mock.Anything).Return(true, nil)
+	client.On("GetBlockNumber", mock.Anything).Return(42, nil)
+
+	sup := lifecycle.NewSupervisor(context.Background())
+	sup.Start(NewChecker(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return client
+	}))
+
+	assert.Eventually(t, func() bool { return lb.BlockOf(lb.Snapshot().Backends[1]) == 42 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, sup.Stop(ctx))
+}
+
+func TestChecker_ConcurrentWithTrafficAndSnapshots(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends:    []string{"http://node1", "http://node2", "http://node3"},
+		HealthCheckInterval: time.Millisecond,
+	}
+	lb := proxy.NewLoadBalancer(cfg)
+
+	client := new(MockClient)
+	client.On("IsReady", mock.Anything).Return(true, nil)
+	client.On("GetBlockNumber", mock.Anything).Return(42, nil)
+
+	sup := lifecycle.NewSupervisor(context.Background())
+	sup.Start(NewChecker(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return client
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if b := lb.Select(proxy.Criteria{}); b != nil {
+					lb.IncSuccessfulRequest(b, 200, time.Millisecond)
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			_, err := json.Marshal(lb.Snapshot())
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, sup.Stop(ctx))
+
+	var total int64
+	for _, b := range lb.Snapshot().Backends {
+		total += b.RequestStats.TotalRequests
+	}
+	assert.Equal(t, int64(800), total)
+}
+
+// liveClient answers every loop's calls for a healthy node at block 42
+// without recording them, so the loops can run flat out. Its latest tip
+// alternates between two hashes, a reorg on every poll.
+type liveClient struct {
+	MockClient
+	polls int32
+}
+
+func (c *liveClient) IsReady(ctx context.Context) (bool, error)         { return true, nil }
+func (c *liveClient) GetBlockNumber(ctx context.Context) (int, error)   { return 42, nil }
+func (c *liveClient) HasBlock(ctx context.Context, n int) (bool, error) { return n <= 42, nil }
+
+func (c *liveClient) GetL2Tips(ctx context.Context) (*rpc.L2Tips, error) {
+	hash := "0xa"
+	if atomic.AddInt32(&c.polls, 1)%2 == 0 {
+		hash = "0xb"
+	}
+	return tips(42, hash, 40, 38), nil
+}
+
+func (c *liveClient) GetValidatorsStats(ctx context.Context) (*rpc.GetValidatorsStatsResponse, error) {
+	return &rpc.GetValidatorsStatsResponse{
+		LastProcessedSlot: "22",
+		Stats: map[string]rpc.ValidatorStats{
+			"0x1": {History: []rpc.ValidatorHistoryItem{{Slot: "20", Status: "block-mined"}, {Slot: "21", Status: "attestation-sent"}}},
+			"0x2": {History: []rpc.ValidatorHistoryItem{{Slot: "20", Status: "attestation-sent"}, {Slot: "21", Status: "block-mined"}}},
+		},
+	}, nil
+}
+
+func TestLoops_ConcurrentWithForwardedTraffic(t *testing.T) {
+	var urls []string
+	for i := 0; i < 3; i++ {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"jsonrpc":"2.0","result":42,"id":1}`))
+		}))
+		defer backend.Close()
+		urls = append(urls, backend.URL)
+	}
+	cfg := &config.Config{
+		SentinelBackends:       urls,
+		HealthCheckInterval:    time.Millisecond,
+		IntegrityCheckInterval: 5 * time.Millisecond,
+		TipsPollInterval:       5 * time.Millisecond,
+		SlotsPerEpoch:          2,
+		ExpectedValidators:     2,
+		IntegrityCheckEpochs:   10,
+		CacheEnabled:           true,
+		CacheMaxBytes:          1 << 20,
+		CoalesceEnabled:        true,
+		CoalesceMethods:        []string{"node_getBlockNumber"},
+	}
+	lb := proxy.NewLoadBalancer(cfg)
+	f := proxy.NewRequestForwarder(cfg, lb)
+
+	client := &liveClient{}
+	factory := func(url string, timeout time.Duration) rpc.RPCClient { return client }
+
+	sup := lifecycle.NewSupervisor(context.Background())
+	sup.Start(NewChecker(cfg, lb).WithClientFactory(factory))
+	sup.Start(NewIntegrityChecker(cfg, lb).WithClientFactory(factory))
+	sup.Start(NewTipsTracker(cfg, lb).WithClientFactory(factory))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w := httptest.NewRecorder()
+				f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlockNumber","id":1}`)))
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			_, err := json.Marshal(lb.Snapshot())
+			assert.NoError(t, err)
+		}
+	}()
+	wg.Wait()
+
+	// Every loop has published into the pool the traffic was routed through
+	assert.Eventually(t, func() bool {
+		snap := lb.Snapshot()
+		return snap.ChainTips.Latest == 42 && snap.Backends[0].IntegrityStats.Status == "perfect" && snap.Backends[0].BlockNumber == 42
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, sup.Stop(ctx))
+}
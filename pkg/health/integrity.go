@@ -9,6 +9,7 @@ import (
 
 	"github.com/DashNode-Org/sentinel-proxy/config"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/integrity"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/lifecycle"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
 	"github.com/rs/zerolog/log"
@@ -36,18 +37,15 @@ func (c *IntegrityChecker) WithClientFactory(f func(url string, timeout time.Dur
 	return c
 }
 
-func (c *IntegrityChecker) Start() {
-	go func() {
-		ticker := time.NewTicker(c.cfg.IntegrityCheckInterval)
-		for range ticker.C {
-			c.CheckIntegrity()
-		}
-	}()
-	c.CheckIntegrity()
+func (c *IntegrityChecker) Name() string { return "integrity" }
+
+// Run checks integrity every IntegrityCheckInterval until ctx is cancelled.
+func (c *IntegrityChecker) Run(ctx context.Context) {
+	lifecycle.Every(ctx, c.cfg.IntegrityCheckInterval, c.CheckIntegrity)
 }
 
-func (c *IntegrityChecker) CheckIntegrity() {
-	backends := c.lb.GetBackends()
+func (c *IntegrityChecker) CheckIntegrity(ctx context.Context) {
+	backends := c.lb.Snapshot().Backends
 	var wg sync.WaitGroup
 
 	for _, b := range backends {
@@ -55,17 +53,21 @@ func (c *IntegrityChecker) CheckIntegrity() {
 			continue
 		}
 		wg.Add(1)
-		go func(url string) {
+		go func(url string, head, oldest int) {
 			defer wg.Done()
-			c.checkBackendIntegrity(url)
-		}(b.URL)
+			c.checkBackendIntegrity(ctx, url)
+			c.checkRetention(ctx, url, head, oldest)
+		}(b.URL, b.BlockNumber, b.OldestBlock)
 	}
 	wg.Wait()
 }
 
-func (c *IntegrityChecker) checkBackendIntegrity(url string) {
+func (c *IntegrityChecker) checkBackendIntegrity(ctx context.Context, url string) {
 	client := c.clientFactory(url, c.cfg.RequestTimeout)
-	stats, err := client.GetValidatorsStats(context.Background())
+	stats, err := client.GetValidatorsStats(ctx)
+	if ctx.Err() != nil {
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Str("url", url).Msg("Failed to fetch validator stats")
 		return
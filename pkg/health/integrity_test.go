@@ -2,6 +2,7 @@ package health
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -17,6 +18,24 @@ type MockClient struct {
 	mock.Mock
 }
 
+func (m *MockClient) Call(ctx context.Context, method string, params ...interface{}) (json.RawMessage, error) {
+	args := m.Called(ctx, method)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(json.RawMessage), args.Error(1)
+}
+
+func (m *MockClient) GetNodeVersion(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockClient) GetProtocolVersion(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *MockClient) IsReady(ctx context.Context) (bool, error) {
 	args := m.Called(ctx)
 	return args.Bool(0), args.Error(1)
@@ -27,6 +46,11 @@ func (m *MockClient) GetBlockNumber(ctx context.Context) (int, error) {
 	return args.Int(0), args.Error(1)
 }
 
+func (m *MockClient) HasBlock(ctx context.Context, n int) (bool, error) {
+	args := m.Called(ctx, n)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockClient) GetValidatorsStats(ctx context.Context) (*rpc.GetValidatorsStatsResponse, error) {
 	args := m.Called(ctx)
 	if args.Get(0) == nil {
@@ -35,6 +59,14 @@ func (m *MockClient) GetValidatorsStats(ctx context.Context) (*rpc.GetValidators
 	return args.Get(0).(*rpc.GetValidatorsStatsResponse), args.Error(1)
 }
 
+func (m *MockClient) GetL2Tips(ctx context.Context) (*rpc.L2Tips, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*rpc.L2Tips), args.Error(1)
+}
+
 func TestIntegrityChecker_PerfectHealth(t *testing.T) {
 	// Setup
 	cfg := &config.Config{
@@ -85,11 +117,11 @@ func TestIntegrityChecker_PerfectHealth(t *testing.T) {
 	mockClient.On("GetValidatorsStats", mock.Anything).Return(mockStats, nil)
 
 	// Action
-	ic.CheckIntegrity()
+	ic.CheckIntegrity(context.Background())
 
 	// Assert
 	// Backend score should be 100
-	backends := lb.GetBackends()
+	backends := lb.Snapshot().Backends
 	assert.Equal(t, 100, backends[0].IntegrityStats.Score)
 	assert.Equal(t, 120.0, backends[0].IntegrityStats.Priority) // Max priority (100 base + 20 health)
 }
@@ -126,9 +158,9 @@ func TestIntegrityChecker_MissingEpochs(t *testing.T) {
 	}
 	mockClient.On("GetValidatorsStats", mock.Anything).Return(mockStats, nil)
 
-	ic.CheckIntegrity()
+	ic.CheckIntegrity(context.Background())
 
-	backends := lb.GetBackends()
+	backends := lb.Snapshot().Backends
 	assert.Equal(t, 1, len(backends[0].IntegrityStats.MissingEpochs))
 	// Use EqualValues for loose type check (int vs int64)
 	assert.EqualValues(t, 101, backends[0].IntegrityStats.MissingEpochs[0])
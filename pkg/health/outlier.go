@@ -0,0 +1,30 @@
+package health
+
+import (
+	"context"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/lifecycle"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+)
+
+// OutlierDetector periodically ejects backends whose latency or error rate
+// stands out from the rest of the pool.
+type OutlierDetector struct {
+	cfg *config.Config
+	lb  *proxy.LoadBalancer
+}
+
+func NewOutlierDetector(cfg *config.Config, lb *proxy.LoadBalancer) *OutlierDetector {
+	return &OutlierDetector{cfg: cfg, lb: lb}
+}
+
+func (d *OutlierDetector) Name() string { return "outliers" }
+
+// Run detects outliers every OutlierInterval until ctx is cancelled; a zero
+// interval disables detection.
+func (d *OutlierDetector) Run(ctx context.Context) {
+	lifecycle.Every(ctx, d.cfg.OutlierInterval, func(context.Context) {
+		d.lb.DetectOutliers()
+	})
+}
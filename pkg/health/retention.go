@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
+	"github.com/rs/zerolog/log"
+)
+
+// errHeadMissing is returned when a node does not serve its own head block,
+// leaving no retained block to bound the search with.
+var errHeadMissing = errors.New("head block not served")
+
+// checkRetention measures the oldest block a backend retains and publishes it
+// as the backend's retention floor, so calls for older blocks are never routed
+// there. The previous floor is confirmed with two lookups; only when it moved
+// is the range between block 1 and the head bisected again.
+func (c *IntegrityChecker) checkRetention(ctx context.Context, url string, head, known int) {
+	if head < 1 {
+		return
+	}
+	client := c.clientFactory(url, c.cfg.RequestTimeout)
+
+	floor, err := oldestBlock(ctx, client, head, known)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("url", url).Msg("Failed to probe block retention")
+		return
+	}
+	c.lb.SetOldestBlock(url, floor)
+}
+
+// oldestBlock returns the lowest block at or below head that the node serves,
+// or 0 when it serves the full history. known is the previous result, 0 if none.
+func oldestBlock(ctx context.Context, client rpc.RPCClient, head, known int) (int, error) {
+	if known > 1 && known <= head {
+		has, err := client.HasBlock(ctx, known)
+		if err != nil {
+			return 0, err
+		}
+		if has {
+			older, err := client.HasBlock(ctx, known-1)
+			if err != nil {
+				return 0, err
+			}
+			if !older {
+				return known, nil
+			}
+		}
+	}
+
+	has, err := client.HasBlock(ctx, 1)
+	if err != nil || has {
+		return 0, err
+	}
+	if has, err := client.HasBlock(ctx, head); err != nil || !has {
+		if err == nil {
+			err = errHeadMissing
+		}
+		return 0, err
+	}
+
+	// Block lo is pruned and block hi is retained
+	lo, hi := 1, head
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		has, err := client.HasBlock(ctx, mid)
+		if err != nil {
+			return 0, err
+		}
+		if has {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, nil
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// retainingClient serves the blocks from oldest to head.
+type retainingClient struct {
+	MockClient
+	oldest, head int
+	lookups      int
+}
+
+func newRetainingClient(oldest, head int) *retainingClient {
+	return &retainingClient{oldest: oldest, head: head}
+}
+
+func (c *retainingClient) HasBlock(ctx context.Context, n int) (bool, error) {
+	c.lookups++
+	return n >= c.oldest && n <= c.head, nil
+}
+
+func TestOldestBlock(t *testing.T) {
+	floor, err := oldestBlock(context.Background(), newRetainingClient(1, 1000), 1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, floor, "a node serving block 1 retains the full history")
+
+	floor, err = oldestBlock(context.Background(), newRetainingClient(377, 1000), 1000, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 377, floor)
+
+	m := newRetainingClient(377, 1000)
+	floor, err = oldestBlock(context.Background(), m, 1000, 377)
+	assert.NoError(t, err)
+	assert.Equal(t, 377, floor)
+	assert.Equal(t, 2, m.lookups, "an unchanged floor is only confirmed")
+
+	floor, err = oldestBlock(context.Background(), newRetainingClient(400, 1000), 1000, 377)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, floor, "a floor that moved is searched again")
+
+	_, err = oldestBlock(context.Background(), newRetainingClient(2000, 3000), 1000, 0)
+	assert.Error(t, err, "a node not serving its head leaves the floor unknown")
+}
+
+func TestIntegrityChecker_PublishesRetention(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://node1"}, SlotsPerEpoch: 32, IntegrityCheckEpochs: 5}
+	lb := proxy.NewLoadBalancer(cfg)
+	lb.UpdateBackendStateByUrl("http://node1", func(b *proxy.Backend) { b.BlockNumber = 500 })
+
+	mockClient := newRetainingClient(120, 500)
+	mockClient.On("GetValidatorsStats", mock.Anything).Return(&rpc.GetValidatorsStatsResponse{LastProcessedSlot: "0"}, nil)
+	ic := NewIntegrityChecker(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return mockClient
+	})
+
+	ic.CheckIntegrity(context.Background())
+	assert.Equal(t, 120, lb.Snapshot().Backends[0].OldestBlock)
+}
@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/lifecycle"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
+	"github.com/rs/zerolog/log"
+)
+
+// TipsTracker polls node_getL2Tips across healthy backends and publishes the
+// pool-wide chain tips to the load balancer, flagging reorgs.
+type TipsTracker struct {
+	cfg           *config.Config
+	lb            *proxy.LoadBalancer
+	clientFactory func(url string, timeout time.Duration) rpc.RPCClient
+
+	mu   sync.Mutex
+	last map[string]rpc.L2Tips // Previous tips per backend, for reorg detection
+}
+
+func NewTipsTracker(cfg *config.Config, lb *proxy.LoadBalancer) *TipsTracker {
+	return &TipsTracker{
+		cfg: cfg,
+		lb:  lb,
+		clientFactory: func(url string, timeout time.Duration) rpc.RPCClient {
+			return rpc.NewClient(url, timeout)
+		},
+		last: make(map[string]rpc.L2Tips),
+	}
+}
+
+// WithClientFactory allows injecting a mock factory for testing
+func (t *TipsTracker) WithClientFactory(f func(url string, timeout time.Duration) rpc.RPCClient) *TipsTracker {
+	t.clientFactory = f
+	return t
+}
+
+func (t *TipsTracker) Name() string { return "tips" }
+
+// Run polls every TipsPollInterval until ctx is cancelled.
+func (t *TipsTracker) Run(ctx context.Context) {
+	lifecycle.Every(ctx, t.cfg.TipsPollInterval, t.Poll)
+}
+
+// Poll fetches tips from every healthy backend and publishes the pool view:
+// the highest latest tip, and the lowest proven and finalized tips so a single
+// node running ahead cannot mark data immutable early.
+func (t *TipsTracker) Poll(ctx context.Context) {
+	backends := t.lb.Snapshot().Backends
+
+	var (
+		wg      sync.WaitGroup
+		resMu   sync.Mutex
+		results = make(map[string]*rpc.L2Tips)
+	)
+	for _, b := range backends {
+		if !b.Healthy {
+			continue
+		}
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			client := t.clientFactory(url, t.cfg.RequestTimeout)
+			tips, err := client.GetL2Tips(ctx)
+			if err != nil {
+				log.Debug().Err(err).Str("url", url).Msg("Failed to fetch L2 tips")
+				return
+			}
+			resMu.Lock()
+			results[url] = tips
+			resMu.Unlock()
+		}(b.URL)
+	}
+	wg.Wait()
+
+	if len(results) == 0 {
+		return
+	}
+
+	var pool proxy.ChainTips
+	first := true
+	reorg := false
+
+	t.mu.Lock()
+	for url, tips := range results {
+		if prev, ok := t.last[url]; ok && isReorg(prev, *tips) {
+			log.Warn().Str("url", url).Int("previous", prev.Latest.Number).Int("latest", tips.Latest.Number).Msg("Reorg detected on backend")
+			reorg = true
+		}
+		t.last[url] = *tips
+
+		if first || tips.Latest.Number > pool.Latest {
+			pool.Latest = tips.Latest.Number
+			pool.LatestHash = tips.Latest.Hash
+		}
+		if first || tips.Proven.Number < pool.Proven {
+			pool.Proven = tips.Proven.Number
+		}
+		if first || tips.Finalized.Number < pool.Finalized {
+			pool.Finalized = tips.Finalized.Number
+		}
+		first = false
+	}
+	t.mu.Unlock()
+
+	t.lb.UpdateChainTips(pool, reorg)
+}
+
+// isReorg reports whether a backend's chain went backwards or replaced the
+// block at its previous tip.
+func isReorg(prev, next rpc.L2Tips) bool {
+	if next.Latest.Number < prev.Latest.Number || next.Proven.Number < prev.Proven.Number {
+		return true
+	}
+	return next.Latest.Number == prev.Latest.Number && prev.Latest.Hash != "" && next.Latest.Hash != prev.Latest.Hash
+}
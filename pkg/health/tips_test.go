@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func tips(latest int, hash string, proven, finalized int) *rpc.L2Tips {
+	return &rpc.L2Tips{
+		Latest:    rpc.L2BlockId{Number: latest, Hash: hash},
+		Proven:    rpc.L2BlockId{Number: proven},
+		Finalized: rpc.L2BlockId{Number: finalized},
+	}
+}
+
+func TestTipsTracker_PoolTips(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://node1", "http://node2"}}
+	lb := proxy.NewLoadBalancer(cfg)
+
+	clients := map[string]*MockClient{"http://node1": new(MockClient), "http://node2": new(MockClient)}
+	clients["http://node1"].On("GetL2Tips", mock.Anything).Return(tips(110, "0xa", 100, 90), nil)
+	clients["http://node2"].On("GetL2Tips", mock.Anything).Return(tips(105, "0xb", 98, 92), nil)
+
+	tt := NewTipsTracker(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return clients[url]
+	})
+	tt.Poll(context.Background())
+
+	got := lb.ChainTips()
+	assert.Equal(t, 110, got.Latest)
+	assert.Equal(t, "0xa", got.LatestHash)
+	assert.Equal(t, 98, got.Proven, "proven tip is the most conservative across backends")
+	assert.Equal(t, 90, got.Finalized)
+}
+
+func TestTipsTracker_DetectsReorg(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://node1"}}
+	lb := proxy.NewLoadBalancer(cfg)
+
+	var reorgs []bool
+	lb.OnChainTips(func(prev, next proxy.ChainTips, reorg bool) {
+		reorgs = append(reorgs, reorg)
+	})
+
+	client := new(MockClient)
+	tt := NewTipsTracker(cfg, lb).WithClientFactory(func(url string, timeout time.Duration) rpc.RPCClient {
+		return client
+	})
+
+	client.On("GetL2Tips", mock.Anything).Return(tips(10, "0xa", 8, 8), nil).Once()
+	tt.Poll(context.Background())
+	client.On("GetL2Tips", mock.Anything).Return(tips(11, "0xb", 8, 8), nil).Once()
+	tt.Poll(context.Background())
+	// Same height, different hash: the tip block was replaced
+	client.On("GetL2Tips", mock.Anything).Return(tips(11, "0xc", 8, 8), nil).Once()
+	tt.Poll(context.Background())
+
+	assert.Equal(t, []bool{false, false, true}, reorgs)
+}
@@ -0,0 +1,92 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Component is a background loop owned by a Supervisor. Run blocks until ctx
+// is cancelled and returns once the component has stopped.
+type Component interface {
+	Name() string
+	Run(ctx context.Context)
+}
+
+// Supervisor owns the root context of the background components: it starts
+// each one in its own goroutine and, on Stop, cancels them all and waits for
+// them to return.
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewSupervisor(parent context.Context) *Supervisor {
+	ctx, cancel := context.WithCancel(parent)
+	return &Supervisor{ctx: ctx, cancel: cancel}
+}
+
+// Start runs c until the supervisor stops.
+func (s *Supervisor) Start(c Component) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		log.Debug().Str("component", c.Name()).Msg("Component started")
+		c.Run(s.ctx)
+		log.Debug().Str("component", c.Name()).Msg("Component stopped")
+	}()
+}
+
+// Stop cancels every component and waits for them to return, or for ctx to
+// end first.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Every calls fn immediately and then every interval until ctx is cancelled.
+// Runs never overlap: a run that takes longer than the interval delays the
+// next one instead. Every returns at once when interval is not positive.
+func Every(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		fn(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sleep waits for d and reports whether it elapsed before ctx was cancelled.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
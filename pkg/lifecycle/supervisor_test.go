@@ -0,0 +1,79 @@
+package lifecycle
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type loop struct {
+	runs    atomic.Int32
+	active  atomic.Int32
+	overlap atomic.Bool
+	work    time.Duration
+}
+
+func (l *loop) Name() string { return "loop" }
+
+func (l *loop) Run(ctx context.Context) {
+	Every(ctx, time.Millisecond, func(ctx context.Context) {
+		if l.active.Add(1) > 1 {
+			l.overlap.Store(true)
+		}
+		l.runs.Add(1)
+		Sleep(ctx, l.work)
+		l.active.Add(-1)
+	})
+}
+
+type stuck struct{}
+
+func (stuck) Name() string { return "stuck" }
+
+func (stuck) Run(context.Context) { select {} }
+
+func TestSupervisor_StopJoinsComponents(t *testing.T) {
+	s := NewSupervisor(context.Background())
+	a, b := &loop{}, &loop{work: 5 * time.Millisecond}
+	s.Start(a)
+	s.Start(b)
+
+	assert.Eventually(t, func() bool { return a.runs.Load() > 3 && b.runs.Load() > 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, s.Stop(ctx))
+
+	runs := a.runs.Load()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, runs, a.runs.Load(), "no runs after Stop returns")
+	assert.False(t, b.overlap.Load(), "slow runs must not overlap")
+}
+
+func TestSupervisor_StopTimesOut(t *testing.T) {
+	s := NewSupervisor(context.Background())
+	s.Start(stuck{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Stop(ctx), context.DeadlineExceeded)
+}
+
+func TestEvery_RunsImmediately(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := 0
+	Every(ctx, time.Hour, func(context.Context) {
+		runs++
+		cancel()
+	})
+	assert.Equal(t, 1, runs)
+}
+
+func TestEvery_DisabledWithoutInterval(t *testing.T) {
+	runs := 0
+	Every(context.Background(), 0, func(context.Context) { runs++ })
+	assert.Zero(t, runs)
+}
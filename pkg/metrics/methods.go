@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"maps"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// OtherMethod is the method label of calls to methods not labelled by name.
+const OtherMethod = "other"
+
+// DefaultMaxMethods is the number of methods labelled by name unless
+// SetMaxMethods says otherwise.
+const DefaultMaxMethods = 100
+
+// methods holds the JSON-RPC methods labelled by name. Clients can send any
+// method name, so a method only gets its own label once a backend has served
+// it, and only up to a limit; every other call is labelled "other" to keep
+// the number of series bounded. The set is read on every request and rarely
+// changes, so it is replaced on write and read without locking.
+var methods = struct {
+	sync.Mutex // Serializes writers
+	known      atomic.Pointer[map[string]bool]
+	max        atomic.Int64
+}{}
+
+func init() {
+	methods.known.Store(&map[string]bool{})
+	methods.max.Store(DefaultMaxMethods)
+}
+
+// SetMaxMethods sets how many methods are labelled by name.
+func SetMaxMethods(n int) {
+	methods.max.Store(int64(n))
+}
+
+// LearnMethod labels method by name from now on, unless the limit is reached.
+func LearnMethod(method string) {
+	if known := *methods.known.Load(); known[method] || int64(len(known)) >= methods.max.Load() {
+		return
+	}
+
+	methods.Lock()
+	defer methods.Unlock()
+	known := *methods.known.Load()
+	if known[method] || int64(len(known)) >= methods.max.Load() {
+		return
+	}
+	next := maps.Clone(known)
+	next[method] = true
+	methods.known.Store(&next)
+}
+
+// MethodLabel returns the label of a JSON-RPC method: its name once learned,
+// "other" otherwise.
+func MethodLabel(method string) string {
+	if (*methods.known.Load())[method] {
+		return method
+	}
+	return OtherMethod
+}
+
+// codeLabel returns the label of a JSON-RPC error code. Codes outside the
+// range reserved by the JSON-RPC spec are application defined and unbounded.
+func codeLabel(code int) string {
+	if code >= -32768 && code <= -32000 {
+		return strconv.Itoa(code)
+	}
+	return "other"
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// resetMethods forgets the learned methods.
+func resetMethods(t *testing.T, max int) {
+	methods.known.Store(&map[string]bool{})
+	SetMaxMethods(max)
+	t.Cleanup(func() { SetMaxMethods(DefaultMaxMethods) })
+}
+
+func TestMethodLabel(t *testing.T) {
+	resetMethods(t, DefaultMaxMethods)
+	assert.Equal(t, OtherMethod, MethodLabel("node_getFoo"), "unknown until a backend serves it")
+
+	LearnMethod("node_getFoo")
+	assert.Equal(t, "node_getFoo", MethodLabel("node_getFoo"))
+	assert.Equal(t, OtherMethod, MethodLabel("node_getBar"))
+}
+
+func TestLearnMethod_Limit(t *testing.T) {
+	resetMethods(t, 3)
+
+	for i := 0; i < 10; i++ {
+		LearnMethod(fmt.Sprintf("spam_%d", i))
+	}
+	assert.Equal(t, "spam_2", MethodLabel("spam_2"))
+	assert.Equal(t, OtherMethod, MethodLabel("spam_3"), "methods past the limit fold into other")
+}
+
+func TestCodeLabel(t *testing.T) {
+	assert.Equal(t, "-32601", codeLabel(-32601))
+	assert.Equal(t, "-32000", codeLabel(-32000))
+	assert.Equal(t, "other", codeLabel(3))
+	assert.Equal(t, "other", codeLabel(-40000))
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -8,15 +10,25 @@ import (
 var (
 	RequestTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "sentinel_proxy_requests_total",
-		Help: "The total number of processed requests",
+		Help: "Backend responses by JSON-RPC method and HTTP status; backend \"none\" counts calls no backend could serve",
 	}, []string{"method", "status", "backend"})
 
 	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "sentinel_proxy_request_duration_seconds",
-		Help:    "The duration of processed requests",
+		Help:    "Duration of backend requests by JSON-RPC method",
 		Buckets: prometheus.DefBuckets,
 	}, []string{"method", "backend"})
 
+	RPCErrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_rpc_errors_total",
+		Help: "Backend responses carrying a JSON-RPC error object, by error code and class (client, backend, retryable)",
+	}, []string{"method", "code", "class", "backend"})
+
+	TransportErrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_transport_errors_total",
+		Help: "Backend requests that failed without a response (connection errors, unreadable bodies)",
+	}, []string{"method", "backend"})
+
 	BackendHealth = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "sentinel_proxy_backend_health",
 		Help: "Current health status of backends (1 = healthy, 0 = unhealthy)",
@@ -31,6 +43,86 @@ var (
 		Name: "sentinel_proxy_backend_block_number",
 		Help: "Latest block number of backends",
 	}, []string{"url"})
+
+	HedgeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_hedged_requests_total",
+		Help: "Requests duplicated onto a second backend after the hedge delay",
+	}, []string{"method"})
+
+	HedgeWinTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_hedge_wins_total",
+		Help: "Hedged requests by the attempt that answered first (primary, hedge)",
+	}, []string{"method", "winner"})
+
+	CoalesceTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_coalesced_requests_total",
+		Help: "Read-only calls by coalescing role; the collapse ratio is follower / (leader + follower)",
+	}, []string{"method", "role"})
+
+	CacheRequestTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_cache_requests_total",
+		Help: "Response cache lookups by result (hit, miss)",
+	}, []string{"method", "result"})
+
+	CacheEvictionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_cache_evictions_total",
+		Help: "Response cache entries removed by reason (capacity, expired, invalidated)",
+	}, []string{"reason"})
+
+	CacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_cache_size_bytes",
+		Help: "Approximate size of the in-memory response cache",
+	})
+
+	BackendLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_backend_lag_blocks",
+		Help: "Blocks a backend is behind the best block of the pool",
+	}, []string{"url"})
+
+	RetryTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_retries_total",
+		Help: "Failover retries by outcome (attempted, budget_exhausted)",
+	}, []string{"outcome"})
+
+	BackendUnsupportedMethods = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_backend_unsupported_methods",
+		Help: "Methods a backend answered with \"method not found\"",
+	}, []string{"url"})
+
+	BackendVersionMismatch = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_backend_version_mismatch",
+		Help: "Backend excluded for not running the target node version (1 = mismatch, 0 = ok)",
+	}, []string{"url"})
+
+	NodeVersions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_node_versions",
+		Help: "Healthy backends per reported node version",
+	}, []string{"version"})
+
+	BackendCircuit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_backend_circuit_state",
+		Help: "Circuit breaker state of backends (0 = closed, 1 = half-open, 2 = open)",
+	}, []string{"url"})
+
+	CircuitTransitionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_circuit_transitions_total",
+		Help: "Circuit breaker state changes by target state",
+	}, []string{"url", "state"})
+
+	BackendEjected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_backend_ejected",
+		Help: "Backend ejected as a latency or error outlier (1 = ejected, 0 = active)",
+	}, []string{"url"})
+
+	OutlierEjectionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_proxy_outlier_ejections_total",
+		Help: "Outlier ejections by reason (latency, errors)",
+	}, []string{"url", "reason"})
+
+	Sessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sentinel_proxy_sessions",
+		Help: "Monotonic-read sessions currently tracked",
+	})
 )
 
 func Register() {
@@ -39,12 +131,22 @@ func Register() {
 
 // RecordRequest increments the request counter
 func RecordRequest(method, status, backend string) {
-	RequestTotal.WithLabelValues(method, status, backend).Inc()
+	RequestTotal.WithLabelValues(MethodLabel(method), status, backend).Inc()
 }
 
 // ObserveRequestDuration observes the request duration
 func ObserveRequestDuration(method, backend string, duration float64) {
-	RequestDuration.WithLabelValues(method, backend).Observe(duration)
+	RequestDuration.WithLabelValues(MethodLabel(method), backend).Observe(duration)
+}
+
+// RecordRPCError increments the JSON-RPC error counter
+func RecordRPCError(method string, code int, class, backend string) {
+	RPCErrorTotal.WithLabelValues(MethodLabel(method), codeLabel(code), class, backend).Inc()
+}
+
+// RecordTransportError increments the transport error counter
+func RecordTransportError(method, backend string) {
+	TransportErrorTotal.WithLabelValues(MethodLabel(method), backend).Inc()
 }
 
 // SetBackendHealth sets the health gauge for a backend
@@ -65,3 +167,111 @@ func SetBackendIntegrity(url string, score int) {
 func SetBackendBlockNumber(url string, blockNum int) {
 	BackendBlockNumber.WithLabelValues(url).Set(float64(blockNum))
 }
+
+// SetBackendLag sets the block lag gauge for a backend
+func SetBackendLag(url string, lag int) {
+	BackendLag.WithLabelValues(url).Set(float64(lag))
+}
+
+// RecordRetry increments the failover retry counter
+func RecordRetry(outcome string) {
+	RetryTotal.WithLabelValues(outcome).Inc()
+}
+
+// RecordHedge increments the hedged request counter
+func RecordHedge(method string) {
+	HedgeTotal.WithLabelValues(MethodLabel(method)).Inc()
+}
+
+// RecordHedgeWin records which attempt of a hedged request answered first
+func RecordHedgeWin(method, winner string) {
+	HedgeWinTotal.WithLabelValues(MethodLabel(method), winner).Inc()
+}
+
+// RecordCoalesce records whether a call led a backend request or shared one
+func RecordCoalesce(method, role string) {
+	CoalesceTotal.WithLabelValues(MethodLabel(method), role).Inc()
+}
+
+// RecordCacheLookup records a response cache hit or miss
+func RecordCacheLookup(method, result string) {
+	CacheRequestTotal.WithLabelValues(MethodLabel(method), result).Inc()
+}
+
+// RecordCacheEviction records a response cache entry removal
+func RecordCacheEviction(reason string) {
+	CacheEvictionTotal.WithLabelValues(reason).Inc()
+}
+
+// SetCacheSize sets the response cache size gauge
+func SetCacheSize(bytes int64) {
+	CacheSize.Set(float64(bytes))
+}
+
+// SetBackendUnsupportedMethods sets the number of methods a backend does not serve
+func SetBackendUnsupportedMethods(url string, n int) {
+	BackendUnsupportedMethods.WithLabelValues(url).Set(float64(n))
+}
+
+// SetBackendVersionMismatch sets the version mismatch gauge
+func SetBackendVersionMismatch(url string, mismatch bool) {
+	val := 0.0
+	if mismatch {
+		val = 1.0
+	}
+	BackendVersionMismatch.WithLabelValues(url).Set(val)
+}
+
+// nodeVersions holds the versions currently exported by NodeVersions
+var nodeVersions = struct {
+	sync.Mutex
+	known map[string]bool
+}{known: make(map[string]bool)}
+
+// SetNodeVersions replaces the per-version backend counts. Counts are set in
+// place and only versions that disappeared are deleted, so a scrape never
+// sees the gauge empty.
+func SetNodeVersions(counts map[string]int) {
+	nodeVersions.Lock()
+	defer nodeVersions.Unlock()
+	for version, n := range counts {
+		NodeVersions.WithLabelValues(version).Set(float64(n))
+	}
+	for version := range nodeVersions.known {
+		if _, ok := counts[version]; !ok {
+			NodeVersions.DeleteLabelValues(version)
+			delete(nodeVersions.known, version)
+		}
+	}
+	for version := range counts {
+		nodeVersions.known[version] = true
+	}
+}
+
+// circuitStates maps breaker states to the circuit gauge value
+var circuitStates = map[string]float64{"closed": 0, "half-open": 1, "open": 2}
+
+// SetBackendCircuit records a circuit breaker state change
+func SetBackendCircuit(url string, state string) {
+	BackendCircuit.WithLabelValues(url).Set(circuitStates[state])
+	CircuitTransitionTotal.WithLabelValues(url, state).Inc()
+}
+
+// SetBackendEjected sets the outlier ejection gauge
+func SetBackendEjected(url string, ejected bool) {
+	val := 0.0
+	if ejected {
+		val = 1.0
+	}
+	BackendEjected.WithLabelValues(url).Set(val)
+}
+
+// RecordOutlierEjection increments the outlier ejection counter
+func RecordOutlierEjection(url, reason string) {
+	OutlierEjectionTotal.WithLabelValues(url, reason).Inc()
+}
+
+// SetSessions sets the number of tracked monotonic-read sessions
+func SetSessions(n int) {
+	Sessions.Set(float64(n))
+}
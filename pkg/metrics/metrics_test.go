@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetNodeVersions(t *testing.T) {
+	SetNodeVersions(map[string]int{"1.0.0": 2, "1.1.0": 1})
+	assert.Equal(t, 2, testutil.CollectAndCount(NodeVersions))
+
+	// Versions still reported are updated in place, vanished ones are deleted
+	SetNodeVersions(map[string]int{"1.1.0": 3, "1.2.0": 1})
+	assert.Equal(t, 2, testutil.CollectAndCount(NodeVersions))
+	assert.Equal(t, 3.0, testutil.ToFloat64(NodeVersions.WithLabelValues("1.1.0")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(NodeVersions.WithLabelValues("1.2.0")))
+
+	SetNodeVersions(nil)
+	assert.Zero(t, testutil.CollectAndCount(NodeVersions))
+}
@@ -1,10 +1,10 @@
 package proxy
 
 import (
-	"math"
 	"math/rand"
-	"strconv"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/DashNode-Org/sentinel-proxy/config"
@@ -12,17 +12,21 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-const (
-	LatencyWindowSize = 100
-)
-
+// RequestStats counts requests and tracks their latency over the last
+// LatencyWindow. The latency fields are filled in snapshots; live stats are
+// read through their methods.
 type RequestStats struct {
-	AvgLatency     time.Duration   `json:"avgLatency"`
-	MaxLatency     time.Duration   `json:"maxLatency"`
-	MinLatency     time.Duration   `json:"minLatency"`
-	TotalRequests  int64           `json:"totalRequests"`
-	TotalErrors    int64           `json:"totalErrors"`
-	LatencyHistory []time.Duration `json:"-"` // Hidden from JSON
+	AvgLatency     time.Duration `json:"avgLatency"`
+	MaxLatency     time.Duration `json:"maxLatency"`
+	MinLatency     time.Duration `json:"minLatency"`
+	P50Latency     time.Duration `json:"p50Latency"`
+	P90Latency     time.Duration `json:"p90Latency"`
+	P99Latency     time.Duration `json:"p99Latency"`
+	LatencySamples int64         `json:"latencySamples"` // Samples in the latency window
+	TotalRequests  int64         `json:"totalRequests"`  // Updated atomically
+	TotalErrors    int64         `json:"totalErrors"`    // Updated atomically
+
+	latency latencySketch
 }
 
 type IntegrityStats struct {
@@ -41,20 +45,90 @@ type EpochStats struct {
 }
 
 type Backend struct {
-	URL            string          `json:"url"`
-	Healthy        bool            `json:"healthy"`
-	BlockNumber    int             `json:"blockNumber"`
-	LastChecked    time.Time       `json:"lastCheck"`
-	NodeType       string          `json:"nodeType"`
-	IntegrityStats *IntegrityStats `json:"integrityStats"`
-	EpochStats     *EpochStats     `json:"epochStats"`
-	RequestStats   *RequestStats   `json:"requestStats"`
+	URL                string          `json:"url"`
+	Healthy            bool            `json:"healthy"`
+	BlockNumber        int             `json:"blockNumber"`
+	Lag                int             `json:"lag"`         // Blocks behind the pool's best block
+	Lagging            bool            `json:"lagging"`     // Quarantined for exceeding the max lag
+	OldestBlock        int             `json:"oldestBlock"` // Lowest block known to be retained, 0 if unknown or the full history
+	LastChecked        time.Time       `json:"lastCheck"`
+	HealthFailures     int             `json:"healthFailures"`  // Consecutive failed health checks
+	HealthSuccesses    int             `json:"healthSuccesses"` // Consecutive passed health checks
+	NodeType           string          `json:"nodeType"`
+	NodeVersion        string          `json:"nodeVersion"`     // Reported by node_getNodeVersion
+	ProtocolVersion    int             `json:"protocolVersion"` // Reported by node_getVersion
+	VersionMismatch    bool            `json:"versionMismatch"` // Not running the pool's target version
+	Circuit            string          `json:"circuit"`         // Circuit breaker state
+	Ejected            bool            `json:"ejected"`         // Ejected as a latency or error outlier
+	EjectedUntil       time.Time       `json:"ejectedUntil"`
+	Ejections          int             `json:"ejections"` // Recent ejections, lengthening the next one
+	SlowStart          float64         `json:"slowStart"` // Share of full weight while ramping up after recovery, 0 when not ramping; filled in snapshots
+	SlowStartUntil     time.Time       `json:"slowStartUntil"`
+	UnsupportedMethods map[string]bool `json:"unsupportedMethods,omitempty"` // Methods answered with "method not found"
+	IntegrityStats     *IntegrityStats `json:"integrityStats"`
+	EpochStats         *EpochStats     `json:"epochStats"`
+	RequestStats       *RequestStats   `json:"requestStats"`
+	HealthStats        *RequestStats   `json:"healthStats"` // Health checks: totals count checks and failed checks
+
+	load    *backendLoad    // Live in-flight count and peak-EWMA latency
+	breaker *circuitBreaker // Trips on live traffic failures
+	outlier outlierStats    // Request counters at the previous outlier detection
+	ramp    *slowStart      // Slow start after recovery, nil when not ramping
+	origin  *Backend        // Live backend of a routing copy, nil on the live backend
+}
+
+// Criteria narrows the set of backends eligible to serve a request.
+type Criteria struct {
+	NodeType       string          // Required node type ("archiver", "pruned"), empty for any
+	PreferNodeType string          // Node type tried first when NodeType is empty
+	Method         string          // JSON-RPC method being served, if known
+	Exclude        map[string]bool // Backend URLs already tried for this request
+	MinBlock       int             // Lowest acceptable backend block, 0 for any
+	NodeVersion    string          // Required node version, overriding the version policy
+	Blocks         *Span           // Blocks the backend must retain, nil for none
+	Slots          *Span           // Slots the backend must retain, nil for none
+	Key            string          // Request key for consistent hashing, empty for none
+}
+
+// relaxations lists c from strictest to loosest: backends that have reached
+// the end of the requested blocks are tried before those still behind it, and
+// the preferred node type before any node type. The start of the range is
+// never relaxed: a backend that pruned it cannot serve the call.
+func (c Criteria) relaxations() []Criteria {
+	levels := []Criteria{c}
+	if c.Blocks != nil && c.Blocks.To > 0 {
+		loose := c
+		loose.Blocks = &Span{From: c.Blocks.From}
+		levels = append(levels, loose)
+	}
+
+	var out []Criteria
+	for _, l := range levels {
+		if l.PreferNodeType != "" && l.NodeType == "" {
+			preferred := l
+			preferred.NodeType = l.PreferNodeType
+			out = append(out, preferred)
+		}
+		out = append(out, l)
+	}
+	return out
 }
 
+// LoadBalancer owns the backend pool. Writers change backends under mu and
+// publish an immutable view of the routing state; request selection and
+// statistics never take mu.
 type LoadBalancer struct {
-	cfg      *config.Config
-	backends []*Backend
-	mu       sync.RWMutex
+	cfg           *config.Config
+	backends      []*Backend
+	methodStats   sync.Map // Pool-wide latency per method label (string -> *RequestStats)
+	tips          ChainTips
+	bestBlock     int
+	targetVersion string // Node version selected by the version policy, empty for any
+	tipsListeners []ChainTipsListener
+	strategies    map[string]Strategy // Selection strategy per route node type ("" for the default route)
+	view          atomic.Pointer[poolView]
+	generation    uint64 // Number of views published
+	mu            sync.RWMutex
 }
 
 func NewLoadBalancer(cfg *config.Config) *LoadBalancer {
@@ -69,103 +143,181 @@ func NewLoadBalancer(cfg *config.Config) *LoadBalancer {
 				Priority: 100, // Base priority
 			},
 			RequestStats: &RequestStats{},
+			HealthStats:  &RequestStats{},
 			EpochStats:   &EpochStats{},
+			Circuit:      CircuitClosed,
+			load:         newBackendLoad(cfg.LBEWMADecay),
+			breaker:      newCircuitBreaker(cfg),
 		})
 	}
-	return &LoadBalancer{
-		cfg:      cfg,
-		backends: backends,
+
+	strategies := make(map[string]Strategy)
+	for nodeType, name := range map[string]string{
+		"":         cfg.LBStrategy,
+		"archiver": cfg.LBStrategyArchiver,
+		"pruned":   cfg.LBStrategyPruned,
+	} {
+		if name == "" {
+			name = cfg.LBStrategy
+		}
+		s, err := NewStrategy(name, nil)
+		if err != nil {
+			log.Warn().Err(err).Str("route", nodeType).Msg("Falling back to weighted load balancing")
+			s, _ = NewStrategy(StrategyWeighted, nil)
+		}
+		strategies[nodeType] = s
+	}
+
+	switch cfg.SlowStartCurve {
+	case SlowStartLinear, SlowStartExponential, "":
+	default:
+		log.Warn().Str("curve", cfg.SlowStartCurve).Msg("Unknown slow start curve, using linear")
 	}
-}
 
-func (lb *LoadBalancer) GetBackends() []*Backend {
-	lb.mu.RLock()
-	defer lb.mu.RUnlock()
-	return lb.backends
+	lb := &LoadBalancer{
+		cfg:        cfg,
+		backends:   backends,
+		strategies: strategies,
+	}
+	now := time.Now()
+	for _, b := range backends {
+		lb.beginSlowStart(b, now) // Joining the pool counts as turning healthy
+	}
+	lb.publish()
+	return lb
 }
 
-func (lb *LoadBalancer) GetNextBackend() *Backend {
+// SetStrategy replaces the selection strategy of the route serving nodeType
+// ("" for the default route).
+func (lb *LoadBalancer) SetStrategy(nodeType string, s Strategy) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
+	lb.strategies[nodeType] = s
+	lb.publish()
+}
 
-	backends := lb.filterHealthy()
-	if len(backends) == 0 {
-		return nil
-	}
-
-	return lb.selectWeighted(backends)
+func (lb *LoadBalancer) GetNextBackend() *Backend {
+	return lb.Select(Criteria{})
 }
 
 func (lb *LoadBalancer) GetArchiverBackend() *Backend {
-	lb.mu.Lock()
-	defer lb.mu.Unlock()
+	return lb.Select(Criteria{NodeType: "archiver"})
+}
 
-	// Filter for healthy archivers
-	var candidates []*Backend
-	for _, b := range lb.backends {
-		if b.Healthy && b.NodeType == "archiver" {
-			candidates = append(candidates, b)
-		}
-	}
+func (lb *LoadBalancer) GetPrunedBackend() *Backend {
+	return lb.Select(Criteria{NodeType: "pruned"})
+}
 
-	if len(candidates) == 0 {
-		return nil
+// Select picks a backend satisfying the criteria. When no backend has reached
+// the end of the requested range, or none of a preferred node type is
+// available, the requirement is relaxed rather than failing the request. It
+// reads the published view without locking and returns the live backend.
+func (lb *LoadBalancer) Select(c Criteria) *Backend {
+	v := lb.current()
+	strategy := v.strategies[c.NodeType]
+	if strategy == nil {
+		strategy = &weightedStrategy{}
 	}
 
-	return lb.selectWeighted(candidates)
+	now := time.Now()
+	for _, level := range c.relaxations() {
+		if candidates := lb.candidates(v, level, now); len(candidates) > 0 {
+			b := strategy.Pick(candidates, c.Key).live()
+			b.breaker.acquire()
+			return b
+		}
+	}
+	return nil
 }
 
-func (lb *LoadBalancer) GetPrunedBackend() *Backend {
-	lb.mu.Lock()
-	defer lb.mu.Unlock()
-
-	// Filter for healthy pruned nodes
-	var candidates []*Backend
-	for _, b := range lb.backends {
-		if b.Healthy && b.NodeType == "pruned" {
-			candidates = append(candidates, b)
+// available reports whether any backend satisfies c or one of its relaxations.
+func (lb *LoadBalancer) available(c Criteria) bool {
+	v := lb.current()
+	now := time.Now()
+	for _, level := range c.relaxations() {
+		if len(lb.candidates(v, level, now)) > 0 {
+			return true
 		}
 	}
+	return false
+}
 
-	if len(candidates) == 0 {
-		return nil
+// BlockOf returns the last block number reported by backend b.
+func (lb *LoadBalancer) BlockOf(b *Backend) int {
+	if c, ok := lb.current().byURL[b.URL]; ok {
+		return c.BlockNumber
 	}
-
-	return lb.selectWeighted(candidates)
+	return 0
 }
 
 func (lb *LoadBalancer) UpdateBackendStateByUrl(url string, updateOp func(*Backend)) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
+	if b := lb.lookup(url); b != nil {
+		updateOp(b)
+		lb.recomputeHead()
+		lb.recomputeVersions()
+		lb.computePriority(b)
+		lb.updateMetrics(b)
+		lb.publish()
+	}
+}
+
+// lookup returns the live backend with the given URL. Caller holds lb.mu.
+func (lb *LoadBalancer) lookup(url string) *Backend {
 	for _, b := range lb.backends {
 		if b.URL == url {
-			updateOp(b)
-			lb.computePriority(b)
-			lb.updateMetrics(b)
-			return
+			return b
 		}
 	}
+	return nil
 }
 
-func (lb *LoadBalancer) UpdateBackendHealth(url string, healthy bool, blockNumber int, latency time.Duration) {
+// UpdateBackendHealth records the outcome of a health check and returns
+// whether the backend is now considered healthy. A healthy backend is only
+// marked down after HealthFailureThreshold consecutive failed checks, and an
+// unhealthy one only comes back after HealthSuccessThreshold consecutive
+// passes, so a single flaky check does not flap the backend in and out.
+func (lb *LoadBalancer) UpdateBackendHealth(url string, healthy bool, blockNumber int, latency time.Duration) bool {
+	var now bool
 	lb.UpdateBackendStateByUrl(url, func(b *Backend) {
-		b.Healthy = healthy
-		b.BlockNumber = blockNumber
 		b.LastChecked = time.Now()
 
 		// Ensure stats exist
-		if b.RequestStats == nil {
-			b.RequestStats = &RequestStats{}
+		if b.HealthStats == nil {
+			b.HealthStats = &RequestStats{}
 		}
 
-		// Record health check latency as a sample
-		b.RequestStats.recordLatency(latency)
+		// Health check latency is kept apart from request latency
+		atomic.AddInt64(&b.HealthStats.TotalRequests, 1)
+		if healthy {
+			b.HealthStats.recordLatency(latency)
+		} else {
+			atomic.AddInt64(&b.HealthStats.TotalErrors, 1)
+		}
 
-		if !healthy {
-			log.Warn().Str("url", url).Msg("Backend marked unhealthy")
+		if healthy {
+			b.HealthFailures = 0
+			b.HealthSuccesses++
+			b.BlockNumber = blockNumber
+			lb.endSlowStart(b, b.LastChecked)
+			if !b.Healthy && b.HealthSuccesses >= lb.cfg.HealthSuccessThreshold {
+				b.Healthy = true
+				log.Info().Str("url", url).Int("checks", b.HealthSuccesses).Msg("Backend marked healthy")
+				lb.beginSlowStart(b, b.LastChecked)
+			}
+		} else {
+			b.HealthSuccesses = 0
+			b.HealthFailures++
+			if b.Healthy && b.HealthFailures >= lb.cfg.HealthFailureThreshold {
+				b.Healthy = false
+				log.Warn().Str("url", url).Int("checks", b.HealthFailures).Msg("Backend marked unhealthy")
+			}
 		}
+		now = b.Healthy
 	})
+	return now
 }
 
 func (lb *LoadBalancer) UpdateIntegrityScore(url string, score int, missing []int64, inconsistent []int64) {
@@ -179,64 +331,81 @@ func (lb *LoadBalancer) UpdateIntegrityScore(url string, score int, missing []in
 	})
 }
 
+// IncSuccessfulRequest records a backend response and its latency. 5xx and
+// 429 responses are failures and recorded by IncErrorRequest instead, so
+// failing fast does not make a backend look fast.
 func (lb *LoadBalancer) IncSuccessfulRequest(b *Backend, status int, latency time.Duration) {
-	lb.mu.Lock()
-	defer lb.mu.Unlock()
-	if b.RequestStats == nil {
-		b.RequestStats = &RequestStats{}
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		lb.IncErrorRequest(b)
+		return
 	}
-	b.RequestStats.TotalRequests++
-	b.RequestStats.recordLatency(latency)
-	metrics.RecordRequest("proxy", strconv.Itoa(status), b.URL)
+	rs := lb.requestStats(b)
+	atomic.AddInt64(&rs.TotalRequests, 1)
+	rs.recordLatency(latency)
+	b.load.observe(latency)
+	lb.recordOutcome(b, false)
 }
 
+// IncErrorRequest records a failed request, or a response carrying a
+// JSON-RPC error the backend is at fault for. It counts as an error and a
+// circuit breaker failure; no latency is recorded.
 func (lb *LoadBalancer) IncErrorRequest(b *Backend) {
+	rs := lb.requestStats(b)
+	atomic.AddInt64(&rs.TotalRequests, 1)
+	atomic.AddInt64(&rs.TotalErrors, 1)
+	lb.recordOutcome(b, true)
+}
+
+// requestStats returns the request stats of b, creating them for backends
+// built without any.
+func (lb *LoadBalancer) requestStats(b *Backend) *RequestStats {
+	if rs := b.RequestStats; rs != nil {
+		return rs
+	}
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 	if b.RequestStats == nil {
 		b.RequestStats = &RequestStats{}
 	}
-	b.RequestStats.TotalRequests++
-	b.RequestStats.TotalErrors++
-	metrics.RecordRequest("proxy", "502", b.URL)
+	return b.RequestStats
 }
 
-// recordLatency adds a new latency sample and recalculates stats
-func (rs *RequestStats) recordLatency(d time.Duration) {
-	if rs.LatencyHistory == nil {
-		rs.LatencyHistory = make([]time.Duration, 0, LatencyWindowSize)
+// RecordMethodLatency records a successful call latency for a JSON-RPC method.
+// Stats are kept per metrics label, so methods no backend has served share the
+// "other" entry and client-chosen names cannot grow the map.
+func (lb *LoadBalancer) RecordMethodLatency(method string, latency time.Duration) {
+	label := metrics.MethodLabel(method)
+	v, ok := lb.methodStats.Load(label)
+	if !ok {
+		v, _ = lb.methodStats.LoadOrStore(label, &RequestStats{})
 	}
+	v.(*RequestStats).recordLatency(latency)
+}
 
-	if len(rs.LatencyHistory) < LatencyWindowSize {
-		rs.LatencyHistory = append(rs.LatencyHistory, d)
-	} else {
-		// Simple shift behavior for now (or could use ring buffer index)
-		// For simplicity/readability, let's append and slice.
-		// Optimized: Copy could be faster but N=100 is small.
-		rs.LatencyHistory = append(rs.LatencyHistory[1:], d)
+// MethodLatencyPercentile returns the q-th latency percentile observed for a
+// method and the number of samples it is based on.
+func (lb *LoadBalancer) MethodLatencyPercentile(method string, q float64) (time.Duration, int) {
+	v, ok := lb.methodStats.Load(metrics.MethodLabel(method))
+	if !ok {
+		return 0, 0
 	}
+	rs := v.(*RequestStats)
+	return rs.Percentile(q), rs.samples()
+}
 
-	// Recalculate
-	var total time.Duration
-	var min, max time.Duration
-	if len(rs.LatencyHistory) > 0 {
-		min = rs.LatencyHistory[0]
-		max = rs.LatencyHistory[0]
-	}
+// samples returns the number of latency samples in the window.
+func (rs *RequestStats) samples() int {
+	return int(rs.latency.count(time.Now()))
+}
 
-	for _, l := range rs.LatencyHistory {
-		total += l
-		if l < min {
-			min = l
-		}
-		if l > max {
-			max = l
-		}
-	}
+// Percentile returns the q-th percentile (0-1) of the latency window.
+func (rs *RequestStats) Percentile(q float64) time.Duration {
+	return rs.latency.quantile(q, time.Now())
+}
 
-	rs.AvgLatency = total / time.Duration(len(rs.LatencyHistory))
-	rs.MinLatency = min
-	rs.MaxLatency = max
+// recordLatency adds a latency sample to the window.
+func (rs *RequestStats) recordLatency(d time.Duration) {
+	rs.latency.record(d, time.Now())
 }
 
 func (lb *LoadBalancer) updateMetrics(b *Backend) {
@@ -247,57 +416,58 @@ func (lb *LoadBalancer) updateMetrics(b *Backend) {
 	}
 }
 
-// selectWeighted selects a backend from a list of candidates using weighted logic
-// Assumes lock is NOT held (or logic is safe) but caller usually holds lock.
+// selectWeighted selects a backend from a list of candidates using the
+// priority-weighted pick and the shared random source.
 func (lb *LoadBalancer) selectWeighted(candidates []*Backend) *Backend {
-	if len(candidates) == 1 {
-		return candidates[0]
-	}
+	return pickWeighted(candidates, rand.Float64)
+}
 
-	if candidates[0].IntegrityStats == nil {
-		return candidates[0] // Fallback
+// eligible reports whether the routing copy b may serve a request matching c.
+func (lb *LoadBalancer) eligible(b *Backend, c Criteria, now time.Time) bool {
+	if !b.Healthy || b.Lagging {
+		return false
 	}
-	minPriority := candidates[0].IntegrityStats.Priority
-	for _, b := range candidates {
-		if b.IntegrityStats != nil && b.IntegrityStats.Priority < minPriority {
-			minPriority = b.IntegrityStats.Priority
-		}
+	if b.ejected(now) {
+		return false
 	}
-
-	var totalWeight float64
-	weights := make([]float64, len(candidates))
-	for i, b := range candidates {
-		// Weight calculation: distance from minPriority + base
-		prio := 100.0
-		if b.IntegrityStats != nil {
-			prio = b.IntegrityStats.Priority
-		}
-		w := math.Max(1, prio-minPriority+10)
-		weights[i] = w
-		totalWeight += w
+	allowed, changed := b.breaker.allow()
+	if changed {
+		lb.syncCircuit(b.live()) // Open time elapsed
 	}
-
-	r := rand.Float64() * totalWeight
-
-	var cumulative float64
-	for i, w := range weights {
-		cumulative += w
-		if r < cumulative {
-			return candidates[i]
+	if !allowed {
+		return false
+	}
+	if c.NodeType != "" && b.NodeType != c.NodeType {
+		return false
+	}
+	if c.Exclude[b.URL] {
+		return false
+	}
+	if c.Method != "" && b.UnsupportedMethods[c.Method] {
+		return false
+	}
+	if c.NodeVersion != "" {
+		if b.NodeVersion != c.NodeVersion {
+			return false
 		}
+	} else if b.VersionMismatch {
+		return false
 	}
-
-	return candidates[0]
+	if c.MinBlock > 0 && b.BlockNumber < c.MinBlock {
+		return false
+	}
+	return covers(b, c)
 }
 
-func (lb *LoadBalancer) filterHealthy() []*Backend {
-	var healthy []*Backend
-	for _, b := range lb.backends {
-		if b.Healthy {
-			healthy = append(healthy, b)
-		}
+// excludeURL returns a copy of exclude with url added, leaving the original
+// untouched so criteria can be shared between concurrent attempts.
+func excludeURL(exclude map[string]bool, url string) map[string]bool {
+	out := make(map[string]bool, len(exclude)+1)
+	for u := range exclude {
+		out[u] = true
 	}
-	return healthy
+	out[url] = true
+	return out
 }
 
 func (lb *LoadBalancer) computePriority(b *Backend) {
@@ -313,9 +483,9 @@ func (lb *LoadBalancer) computePriority(b *Backend) {
 	priority -= float64(len(b.IntegrityStats.MissingEpochs) * 10)
 	priority -= float64(len(b.IntegrityStats.InconsistentEpochs) * 5)
 
-	// User removed Latency field. Using RequestStats.AvgLatency instead if needed.
-	if b.RequestStats != nil && b.RequestStats.AvgLatency > 0 {
-		ms := float64(b.RequestStats.AvgLatency.Milliseconds())
+	// Latency bonus
+	if p50 := b.medianLatency(); p50 > 0 {
+		ms := float64(p50.Milliseconds())
 		if ms < 100 {
 			priority += 10
 		} else if ms < 500 {
@@ -330,3 +500,14 @@ func (lb *LoadBalancer) computePriority(b *Backend) {
 
 	b.IntegrityStats.Priority = priority
 }
+
+// medianLatency returns the median latency of the requests b served, or of
+// its health checks while it has not served any recently.
+func (b *Backend) medianLatency() time.Duration {
+	for _, rs := range []*RequestStats{b.RequestStats, b.HealthStats} {
+		if rs != nil && rs.samples() > 0 {
+			return rs.Percentile(0.5)
+		}
+	}
+	return 0
+}
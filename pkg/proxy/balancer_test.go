@@ -71,9 +71,9 @@ func TestNewLoadBalancer(t *testing.T) {
 	}
 	lb := NewLoadBalancer(cfg)
 
-	assert.Equal(t, 2, len(lb.GetBackends()))
-	assert.Equal(t, "http://node1:8545", lb.GetBackends()[0].URL)
-	assert.True(t, lb.GetBackends()[0].Healthy)
+	assert.Equal(t, 2, len(lb.Snapshot().Backends))
+	assert.Equal(t, "http://node1:8545", lb.Snapshot().Backends[0].URL)
+	assert.True(t, lb.Snapshot().Backends[0].Healthy)
 }
 
 func TestGetNextBackend_NoHealthy(t *testing.T) {
@@ -87,14 +87,37 @@ func TestGetNextBackend_NoHealthy(t *testing.T) {
 	assert.Nil(t, b)
 }
 
+func TestUpdateBackendHealth_Hysteresis(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends:       []string{"http://node1"},
+		HealthFailureThreshold: 3,
+		HealthSuccessThreshold: 2,
+	}
+	lb := NewLoadBalancer(cfg)
+
+	// A single flaky check does not take the backend out
+	assert.True(t, lb.UpdateBackendHealth("http://node1", false, 0, 0))
+	assert.True(t, lb.UpdateBackendHealth("http://node1", true, 100, 0))
+	assert.True(t, lb.UpdateBackendHealth("http://node1", false, 0, 0))
+	assert.True(t, lb.UpdateBackendHealth("http://node1", false, 0, 0))
+	assert.Equal(t, 100, lb.Snapshot().Backends[0].BlockNumber, "failed checks keep the last known block")
+
+	assert.False(t, lb.UpdateBackendHealth("http://node1", false, 0, 0), "third consecutive failure")
+	assert.Nil(t, lb.GetNextBackend())
+
+	assert.False(t, lb.UpdateBackendHealth("http://node1", true, 101, 0))
+	assert.True(t, lb.UpdateBackendHealth("http://node1", true, 102, 0), "second consecutive pass")
+	assert.Equal(t, 102, lb.Snapshot().Backends[0].BlockNumber)
+	assert.NotNil(t, lb.GetNextBackend())
+}
+
 func TestGetArchiverBackend(t *testing.T) {
 	cfg := &config.Config{SentinelBackends: []string{"http://archiver", "http://pruned"}}
 	lb := NewLoadBalancer(cfg)
 
 	// Manually set node types since we don't have real RPC
-	backends := lb.GetBackends()
-	backends[0].NodeType = "archiver"
-	backends[1].NodeType = "pruned"
+	lb.UpdateBackendStateByUrl("http://archiver", func(b *Backend) { b.NodeType = "archiver" })
+	lb.UpdateBackendStateByUrl("http://pruned", func(b *Backend) { b.NodeType = "pruned" })
 
 	// Should return archiver
 	b := lb.GetArchiverBackend()
@@ -106,9 +129,8 @@ func TestGetPrunedBackend(t *testing.T) {
 	cfg := &config.Config{SentinelBackends: []string{"http://archiver", "http://pruned"}}
 	lb := NewLoadBalancer(cfg)
 
-	backends := lb.GetBackends()
-	backends[0].NodeType = "archiver"
-	backends[1].NodeType = "pruned"
+	lb.UpdateBackendStateByUrl("http://archiver", func(b *Backend) { b.NodeType = "archiver" })
+	lb.UpdateBackendStateByUrl("http://pruned", func(b *Backend) { b.NodeType = "pruned" })
 
 	b := lb.GetPrunedBackend()
 	assert.NotNil(t, b)
@@ -120,13 +142,13 @@ func TestUpdateIntegrityScore_Priority(t *testing.T) {
 	lb := NewLoadBalancer(cfg)
 
 	// Initial priority
-	initial := lb.GetBackends()[0].IntegrityStats.Priority
+	initial := lb.Snapshot().Backends[0].IntegrityStats.Priority
 
 	// Simulate integrity failure
 	missing := []int64{1, 2, 3}
 	lb.UpdateIntegrityScore("http://node1", 80, missing, nil)
 
-	updated := lb.GetBackends()[0].IntegrityStats.Priority
+	updated := lb.Snapshot().Backends[0].IntegrityStats.Priority
 	assert.Less(t, updated, initial, "Priority should decrease with missing epochs")
 }
 
@@ -136,9 +158,10 @@ func TestPriorityCalculation(t *testing.T) {
 	// Case 1: Healthy, low latency
 	b := &Backend{
 		Healthy:        true,
-		RequestStats:   &RequestStats{AvgLatency: 50 * time.Millisecond},
+		RequestStats:   &RequestStats{},
 		IntegrityStats: &IntegrityStats{Score: 100}, // Base score
 	}
+	b.RequestStats.recordLatency(50 * time.Millisecond)
 
 	// Initial priority: 100 (base) + 20 (Healthy) + 10 (Latency < 100ms) = 130
 	lb.computePriority(b)
@@ -148,7 +171,8 @@ func TestPriorityCalculation(t *testing.T) {
 	}
 
 	// Update latency to slow
-	b.RequestStats.AvgLatency = 600 * time.Millisecond
+	b.RequestStats.recordLatency(600 * time.Millisecond)
+	b.RequestStats.recordLatency(600 * time.Millisecond)
 	lb.computePriority(b)
 	// Priority should decrease due to high latency (e.g., 100 + 20 + 0 = 120 or less)
 	assert.Less(t, b.IntegrityStats.Priority, 130.0, "Priority should decrease with high latency")
@@ -158,3 +182,30 @@ func TestPriorityCalculation(t *testing.T) {
 	lb.computePriority(b)
 	assert.Less(t, b.IntegrityStats.Priority, base-20) // Health bonus lost
 }
+
+func TestLagQuarantine(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends: []string{"http://node1", "http://node2", "http://node3"},
+		MaxBlockLag:      5,
+	}
+	lb := NewLoadBalancer(cfg)
+
+	lb.UpdateBackendHealth("http://node1", true, 100, 0)
+	lb.UpdateBackendHealth("http://node2", true, 97, 0)
+	lb.UpdateBackendHealth("http://node3", true, 50, 0)
+
+	assert.Equal(t, 100, lb.BestBlock())
+	backends := lb.Snapshot().Backends
+	assert.Equal(t, 3, backends[1].Lag)
+	assert.False(t, backends[1].Lagging)
+	assert.Equal(t, 50, backends[2].Lag)
+	assert.True(t, backends[2].Lagging)
+
+	for i := 0; i < 100; i++ {
+		assert.NotEqual(t, "http://node3", lb.GetNextBackend().URL, "lagging backend must not be selected")
+	}
+
+	// Catching up lifts the quarantine
+	lb.UpdateBackendHealth("http://node3", true, 99, 0)
+	assert.False(t, lb.Snapshot().Backends[2].Lagging)
+}
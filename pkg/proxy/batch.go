@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// batchWorkers bounds the number of calls of one batch forwarded at once.
+const batchWorkers = 16
+
+// forwardBatch splits a JSON-RPC batch into individual calls, sends each to a
+// suitable backend, batchWorkers at a time, and reassembles the responses in
+// request order.
+func (f *Forwarder) forwardBatch(w http.ResponseWriter, r *http.Request, rt route, batch []*RPCRequest) {
+	if len(batch) == 0 {
+		writeRPCError(w, http.StatusBadRequest, nullID, RPCCodeInvalidRequest, "Invalid request: empty batch")
+		return
+	}
+	if f.cfg.MaxBatchSize > 0 && len(batch) > f.cfg.MaxBatchSize {
+		writeRPCError(w, http.StatusBadRequest, nullID, RPCCodeInvalidRequest,
+			"Batch too large: maximum is "+strconv.Itoa(f.cfg.MaxBatchSize)+" calls")
+		return
+	}
+
+	responses := make([][]byte, len(batch))
+	blocks := make([]int, len(batch))
+	calls := make(chan int, len(batch))
+	for i, call := range batch {
+		if call == nil {
+			responses[i] = rpcErrorResponse(nullID, RPCCodeInvalidRequest, "Invalid request")
+			continue
+		}
+		calls <- i
+	}
+	close(calls)
+
+	var wg sync.WaitGroup
+	for n := min(len(calls), batchWorkers); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range calls {
+				responses[i], blocks[i] = f.forwardCall(r, rt, batch[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Notifications get no response entry
+	var out [][]byte
+	for i, resp := range responses {
+		if batch[i] != nil && batch[i].IsNotification() {
+			continue
+		}
+		out = append(out, resp)
+	}
+
+	// Report the stalest backend that contributed to the batch
+	stalest := 0
+	for _, block := range blocks {
+		if block > 0 && (stalest == 0 || block < stalest) {
+			stalest = block
+		}
+	}
+	setBackendBlock(w, stalest)
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(out) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(append([]byte{'['}, bytes.Join(out, []byte{','})...), ']'))
+}
+
+// forwardCall sends a single call of a batch as the client sent it and returns
+// its JSON-RPC response and the block of the serving backend, converting any
+// failure into an error object carrying the call's id. Notifications return
+// no response.
+func (f *Forwarder) forwardCall(r *http.Request, rt route, call *RPCRequest) ([]byte, int) {
+	id := call.responseID()
+
+	r = r.WithContext(WithRPCRequest(r.Context(), call))
+	resp, backend, err := f.dispatch(r, rt, call, call.raw)
+	if call.IsNotification() {
+		return nil, 0 // Nothing to answer, whatever the backend replied
+	}
+	if err == errNoBackend {
+		return rpcErrorResponse(id, RPCCodeNoBackend, unavailableMessage(r, rt)), 0
+	}
+	if err == errRangeUnavailable {
+		return rpcErrorResponse(id, RPCCodeRangeUnavailable, rangeUnavailableMessage), 0
+	}
+	if err == errMethodNotSupported {
+		return rpcErrorResponse(id, rpcCodeMethodNotFound, methodNotSupportedMessage), 0
+	}
+	if err != nil {
+		return rpcErrorResponse(id, RPCCodeUpstreamError, "Backend request failed"), 0
+	}
+
+	out, err := withID(resp.body, id)
+	if err != nil {
+		log.Warn().Err(err).Str("backend", backendURL(backend)).Str("method", call.Method).Int("status", resp.status).Msg("Unreadable batch call response")
+		return rpcErrorResponse(id, RPCCodeUpstreamError, "Backend returned an invalid response"), 0
+	}
+	f.observeBlock(r, resp.block)
+	return out, resp.block
+}
+
+// writeRPCError writes a standalone JSON-RPC error response.
+func writeRPCError(w http.ResponseWriter, status int, id json.RawMessage, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(rpcErrorResponse(id, code, message))
+}
+
+// backendURL returns the URL of b for logging, or "cache" for cached responses.
+func backendURL(b *Backend) string {
+	if b == nil {
+		return "cache"
+	}
+	return b.URL
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarder_BatchFanOut(t *testing.T) {
+	archiver := echoBackend("archiver")
+	defer archiver.Close()
+	pruned := echoBackend("pruned")
+	defer pruned.Close()
+
+	cfg := testConfig([]string{archiver.URL, pruned.URL})
+	cfg.MaxBatchSize = 10
+	lb := NewLoadBalancer(cfg)
+	lb.UpdateBackendStateByUrl(archiver.URL, func(b *Backend) { b.NodeType = "archiver" })
+	lb.UpdateBackendStateByUrl(pruned.URL, func(b *Backend) { b.NodeType = "pruned" })
+	f := NewRequestForwarder(cfg, lb)
+
+	body := `[
+		{"jsonrpc":"2.0","method":"node_getValidatorsStats","params":[],"id":"a"},
+		{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[],"id":2},
+		{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[]},
+		{"jsonrpc":"2.0","id":4}
+	]`
+	w := forwardCall(f, body)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var responses []RPCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &responses))
+	if assert.Len(t, responses, 3, "notifications get no response") {
+		assert.JSONEq(t, `"a"`, string(responses[0].ID))
+		assert.JSONEq(t, `"archiver:node_getValidatorsStats"`, string(responses[0].Result))
+
+		assert.JSONEq(t, `2`, string(responses[1].ID))
+		assert.Contains(t, string(responses[1].Result), "node_getBlockNumber")
+
+		assert.JSONEq(t, `null`, string(responses[2].ID))
+		if assert.NotNil(t, responses[2].Error) {
+			assert.Equal(t, RPCCodeInvalidRequest, responses[2].Error.Code)
+		}
+	}
+}
+
+func TestForwarder_BatchTooLarge(t *testing.T) {
+	backend := echoBackend("node")
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL})
+	cfg.MaxBatchSize = 1
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	body := `[{"jsonrpc":"2.0","method":"a","id":1},{"jsonrpc":"2.0","method":"b","id":2}]`
+	w := forwardCall(f, body)
+
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	var resp RPCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.NotNil(t, resp.Error) {
+		assert.Equal(t, RPCCodeInvalidRequest, resp.Error.Code)
+	}
+}
+
+func TestForwarder_BatchNoBackend(t *testing.T) {
+	cfg := testConfig([]string{"http://node1"})
+	lb := NewLoadBalancer(cfg)
+	lb.UpdateBackendHealth("http://node1", false, 0, 0)
+	f := NewRequestForwarder(cfg, lb)
+
+	w := forwardCall(f, `[{"jsonrpc":"2.0","method":"a","id":1}]`)
+
+	var responses []RPCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &responses))
+	if assert.Len(t, responses, 1) && assert.NotNil(t, responses[0].Error) {
+		assert.Equal(t, RPCCodeNoBackend, responses[0].Error.Code)
+		assert.JSONEq(t, `1`, string(responses[0].ID))
+	}
+}
+
+func TestForwarder_EmptyBatch(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL})
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	w := forwardCall(f, ` [ ] `)
+
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Zero(t, atomic.LoadInt32(&hits), "an empty batch is not forwarded")
+
+	var resp RPCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.JSONEq(t, `null`, string(resp.ID))
+	if assert.NotNil(t, resp.Error) {
+		assert.Equal(t, RPCCodeInvalidRequest, resp.Error.Code)
+	}
+}
+
+func TestForwarder_BatchBoundedFanOut(t *testing.T) {
+	var inflight, peak int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		body, _ := io.ReadAll(r.Body)
+		call, _ := ParseRPCRequest(body)
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "result": "ok", "id": call.ID})
+	}))
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}) // MaxBatchSize 0: unlimited
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	calls := make([]string, 4*batchWorkers)
+	for i := range calls {
+		calls[i] = `{"jsonrpc":"2.0","method":"node_getBlockNumber","id":` + strconv.Itoa(i) + `}`
+	}
+	w := forwardCall(f, "["+strings.Join(calls, ",")+"]")
+
+	var responses []RPCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &responses))
+	assert.Len(t, responses, len(calls))
+	assert.LessOrEqual(t, int(atomic.LoadInt32(&peak)), batchWorkers)
+}
+
+func TestForwarder_BatchForwardsCallsVerbatim(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent) // Notifications get no reply
+	}))
+	defer backend.Close()
+
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	defer func() { log.Logger = logger }()
+
+	cfg := testConfig([]string{backend.URL})
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	body := `[{"method":"node_notify","params":[1],"trace":"abc"},{"jsonrpc":"2.0","method":"node_notify"}]`
+	w := forwardCall(f, body)
+
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+	assert.ElementsMatch(t, []string{`{"method":"node_notify","params":[1],"trace":"abc"}`, `{"jsonrpc":"2.0","method":"node_notify"}`}, received,
+		"batch elements reach the backend as the client sent them")
+	assert.NotContains(t, logs.String(), "Unreadable batch call response", "empty notification replies are not an error")
+}
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Circuit breaker states, as reported in Backend.Circuit.
+const (
+	CircuitClosed   = "closed"    // Traffic flows normally
+	CircuitOpen     = "open"      // Backend is skipped until the open time elapses
+	CircuitHalfOpen = "half-open" // A limited number of trial requests decide the next state
+)
+
+// circuitBreaker trips on live traffic failures: too many consecutive failures
+// or too high an error rate over the last window of requests. After the open
+// time it admits a few trial requests; all of them must succeed to close it
+// again, any failure opens it anew. A zero threshold disables that trigger.
+// It is safe for concurrent use; the state is published to Backend.Circuit
+// under lb.mu when it changes. Every request passes through it, so a closed
+// breaker admits requests and a quiet one takes successes without locking.
+type circuitBreaker struct {
+	consecutiveLimit int
+	errorRate        int // Percent
+	openTime         time.Duration
+	trialLimit       int
+	now              func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	consecutive int
+	window      []bool // Recent outcomes, true for a failure
+	next        int
+	failures    int // Failures in window
+	openUntil   time.Time
+	trials      int // Trial requests admitted while half-open
+	successes   int // Successful trial requests
+
+	closed atomic.Bool // state is CircuitClosed
+	quiet  atomic.Bool // Closed with a full window of successes: another success changes nothing
+}
+
+func newCircuitBreaker(cfg *config.Config) *circuitBreaker {
+	cb := &circuitBreaker{
+		consecutiveLimit: cfg.BreakerConsecutiveFailures,
+		errorRate:        cfg.BreakerErrorRatePercent,
+		openTime:         cfg.BreakerOpenTime,
+		trialLimit:       max(cfg.BreakerHalfOpenRequests, 1),
+		now:              time.Now,
+		window:           make([]bool, 0, max(cfg.BreakerWindow, 1)),
+	}
+	cb.close()
+	return cb
+}
+
+// allow reports whether the breaker lets a request through, moving an open
+// breaker to half-open once its open time has elapsed. The second result
+// reports whether that moved the breaker to another state.
+func (cb *circuitBreaker) allow() (bool, bool) {
+	if cb == nil || cb.closed.Load() {
+		return true, false
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	changed := false
+	switch cb.state {
+	case CircuitOpen:
+		if cb.now().Before(cb.openUntil) {
+			return false, false
+		}
+		cb.halfOpen()
+		changed = true
+	case CircuitHalfOpen:
+		if cb.trials >= cb.trialLimit && !cb.now().Before(cb.openUntil) {
+			cb.halfOpen() // Trials never reported back, e.g. cancelled: admit new ones
+		}
+	}
+	return cb.state == CircuitClosed || cb.trials < cb.trialLimit, changed
+}
+
+// acquire accounts for a request selected for the backend; a request that is
+// then never sent, or is cancelled before reporting an outcome, calls release.
+// Concurrent selections between allow and acquire may admit a trial or two
+// beyond the limit.
+func (cb *circuitBreaker) acquire() {
+	if cb == nil || cb.closed.Load() {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == CircuitHalfOpen {
+		cb.trials++
+	}
+}
+
+// release gives back the trial slot taken by acquire for a request that
+// never reported an outcome: it was not sent, or was cancelled in flight.
+func (cb *circuitBreaker) release() {
+	if cb == nil || cb.closed.Load() {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == CircuitHalfOpen && cb.trials > 0 {
+		cb.trials--
+	}
+}
+
+// current returns the breaker state.
+func (cb *circuitBreaker) current() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// record feeds the outcome of a request and returns the new state when it changed.
+func (cb *circuitBreaker) record(failed bool) (string, bool) {
+	if cb == nil || (!failed && cb.quiet.Load()) {
+		return "", false
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case CircuitHalfOpen:
+		if failed {
+			cb.open()
+			return cb.state, true
+		}
+		cb.successes++
+		if cb.successes >= cb.trialLimit {
+			cb.close()
+			return cb.state, true
+		}
+	case CircuitClosed:
+		cb.push(failed)
+		if cb.tripped() {
+			cb.open()
+			return cb.state, true
+		}
+		cb.quiet.Store(cb.consecutive == 0 && cb.failures == 0 && len(cb.window) == cap(cb.window))
+	}
+	return "", false
+}
+
+func (cb *circuitBreaker) push(failed bool) {
+	if failed {
+		cb.consecutive++
+		cb.failures++
+	} else {
+		cb.consecutive = 0
+	}
+	if len(cb.window) < cap(cb.window) {
+		cb.window = append(cb.window, failed)
+		return
+	}
+	if cb.window[cb.next] {
+		cb.failures--
+	}
+	cb.window[cb.next] = failed
+	cb.next = (cb.next + 1) % len(cb.window)
+}
+
+func (cb *circuitBreaker) tripped() bool {
+	if cb.consecutiveLimit > 0 && cb.consecutive >= cb.consecutiveLimit {
+		return true
+	}
+	full := len(cb.window) == cap(cb.window)
+	return cb.errorRate > 0 && full && cb.failures*100 >= cb.errorRate*len(cb.window)
+}
+
+func (cb *circuitBreaker) open() {
+	cb.state = CircuitOpen
+	cb.closed.Store(false)
+	cb.quiet.Store(false)
+	cb.openUntil = cb.now().Add(cb.openTime)
+}
+
+func (cb *circuitBreaker) halfOpen() {
+	cb.state = CircuitHalfOpen
+	cb.closed.Store(false)
+	cb.trials, cb.successes = 0, 0
+	cb.openUntil = cb.now().Add(cb.openTime) // Deadline for the trials to report back
+}
+
+func (cb *circuitBreaker) close() {
+	cb.state = CircuitClosed
+	cb.consecutive, cb.failures, cb.next = 0, 0, 0
+	cb.window = cb.window[:0]
+	cb.quiet.Store(false)
+	cb.closed.Store(true)
+}
+
+// recordOutcome feeds a live request result into b's breaker.
+func (lb *LoadBalancer) recordOutcome(b *Backend, failed bool) {
+	if _, changed := b.breaker.record(failed); changed {
+		lb.syncCircuit(b)
+	}
+}
+
+// syncCircuit publishes the current state of b's breaker after it changed
+// outside of lb.mu.
+func (lb *LoadBalancer) syncCircuit(b *Backend) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.setCircuit(b, b.breaker.current())
+	lb.publish()
+}
+
+// setCircuit publishes a breaker state change. Caller holds lb.mu.
+func (lb *LoadBalancer) setCircuit(b *Backend, state string) {
+	if state == b.Circuit {
+		return
+	}
+	if state == CircuitOpen {
+		log.Warn().Str("url", b.URL).Str("from", b.Circuit).Msg("Circuit opened: backend failing live traffic")
+	} else {
+		log.Info().Str("url", b.URL).Str("from", b.Circuit).Str("to", state).Msg("Circuit state changed")
+	}
+	b.Circuit = state
+	metrics.SetBackendCircuit(b.URL, state)
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	cb := newCircuitBreaker(testConfig(nil, withBreaker))
+
+	cb.record(true)
+	cb.record(true)
+	cb.record(false) // Resets the streak
+	cb.record(true)
+	cb.record(true)
+	assert.Equal(t, CircuitClosed, cb.state)
+
+	state, changed := cb.record(true)
+	assert.True(t, changed)
+	assert.Equal(t, CircuitOpen, state)
+	assert.False(t, allows(cb))
+}
+
+func TestCircuitBreaker_QuietAfterFullWindow(t *testing.T) {
+	cb := newCircuitBreaker(testConfig(nil, withBreaker))
+	for i := 0; i < 10; i++ {
+		cb.record(false)
+	}
+	assert.True(t, cb.quiet.Load(), "a full window of successes takes further successes without locking")
+
+	cb.record(true)
+	assert.False(t, cb.quiet.Load(), "a failure ends the quiet state")
+	cb.record(true)
+	state, changed := cb.record(true)
+	assert.True(t, changed)
+	assert.Equal(t, CircuitOpen, state)
+	assert.False(t, cb.closed.Load())
+}
+
+func TestCircuitBreaker_ErrorRate(t *testing.T) {
+	cfg := testConfig(nil, withBreaker)
+	cfg.BreakerConsecutiveFailures = 0
+	cb := newCircuitBreaker(cfg)
+
+	for i := 0; i < 9; i++ {
+		cb.record(i%2 == 0) // 5 failures out of 9: window not full yet
+	}
+	assert.Equal(t, CircuitClosed, cb.state)
+
+	cb.record(false) // 5 out of 10
+	assert.Equal(t, CircuitOpen, cb.state)
+}
+
+func TestCircuitBreaker_HalfOpenTrials(t *testing.T) {
+	now := time.Now()
+	cb := newCircuitBreaker(testConfig(nil, withBreaker))
+	cb.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		cb.record(true)
+	}
+
+	now = now.Add(time.Minute)
+	assert.True(t, allows(cb))
+	assert.Equal(t, CircuitHalfOpen, cb.state)
+
+	cb.acquire()
+	cb.acquire()
+	assert.False(t, allows(cb), "only a limited number of trial requests")
+	cb.release()
+	assert.True(t, allows(cb), "a trial that was never sent gives its slot back")
+	cb.acquire()
+
+	cb.record(false)
+	assert.Equal(t, CircuitHalfOpen, cb.state)
+	cb.record(false)
+	assert.Equal(t, CircuitClosed, cb.state, "successful trials close the circuit")
+
+	for i := 0; i < 3; i++ {
+		cb.record(true)
+	}
+	now = now.Add(time.Minute)
+	allows(cb)
+	cb.acquire()
+	cb.record(true)
+	assert.Equal(t, CircuitOpen, cb.state, "a failed trial opens the circuit again")
+}
+
+func TestForwarder_ReleasesUnsentTrials(t *testing.T) {
+	f, lb, hits := livePool(t, 1, withBreaker)
+
+	b := lb.backends[0]
+	for i := 0; i < 3; i++ {
+		lb.IncErrorRequest(b)
+	}
+	now := time.Now().Add(time.Minute)
+	b.breaker.now = func() time.Time { return now }
+
+	// Trials cancelled before they reach the backend report no outcome
+	for i := 0; i < f.cfg.BreakerHalfOpenRequests; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		f.Forward(httptest.NewRecorder(), rpcRequest(blockNumberCall).WithContext(ctx))
+	}
+	assert.Zero(t, atomic.LoadInt32(hits[0]))
+	assert.Equal(t, CircuitHalfOpen, b.breaker.current())
+
+	assert.Equal(t, http.StatusOK, forwardCall(f, blockNumberCall).Code, "cancelled trials give their slots back")
+}
+
+func TestCircuitBreaker_DisabledByDefault(t *testing.T) {
+	cb := newCircuitBreaker(&config.Config{})
+	for i := 0; i < 100; i++ {
+		cb.record(true)
+	}
+	assert.True(t, allows(cb))
+}
+
+func TestLoadBalancer_SkipsOpenCircuit(t *testing.T) {
+	lb := testPool(2, withBreaker)
+	failing := lb.backends[0]
+	for i := 0; i < 3; i++ {
+		lb.IncErrorRequest(failing)
+	}
+	lb.IncSuccessfulRequest(lb.backends[1], 200, time.Millisecond)
+
+	assert.Equal(t, CircuitOpen, failing.Circuit)
+	assert.Equal(t, CircuitClosed, lb.backends[1].Circuit)
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "http://node2", lb.Select(Criteria{}).URL)
+	}
+}
+
+func allows(cb *circuitBreaker) bool {
+	ok, _ := cb.allow()
+	return ok
+}
@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// headBlock tags cached entries that depend on the chain head rather than a
+// specific block; they are evicted whenever the tips move.
+const headBlock = math.MaxInt
+
+// cacheTier classifies how long responses of a method stay valid.
+type cacheTier int
+
+const (
+	tierNone      cacheTier = iota
+	tierShort               // Head-dependent data, cached for a short TTL
+	tierImmutable           // Data that never changes once it exists, cached until evicted
+)
+
+// cachePolicies maps JSON-RPC methods to their cache tier. Immutable methods
+// fall back to the short tier when a response is not final yet.
+var cachePolicies = map[string]cacheTier{
+	"node_getBlock":             tierImmutable,
+	"node_getBlocks":            tierImmutable,
+	"node_getBlockHeader":       tierImmutable,
+	"node_getTxReceipt":         tierImmutable,
+	"node_getTxEffect":          tierImmutable,
+	"node_getBlockNumber":       tierShort,
+	"node_getProvenBlockNumber": tierShort,
+	"node_getL2Tips":            tierShort,
+	"node_getNodeInfo":          tierShort,
+	"node_getNodeVersion":       tierShort,
+	"node_getVersion":           tierShort,
+	"node_getChainId":           tierShort,
+}
+
+// pendingReceiptStatuses are tx receipt statuses that may still change.
+var pendingReceiptStatuses = map[string]bool{
+	"pending": true,
+	"dropped": true,
+}
+
+// cacheable reports whether calls to a method are ever served from the cache.
+func (f *Forwarder) cacheable(call *RPCRequest) bool {
+	return f.cache != nil && !call.IsNotification() && cachePolicies[call.Method] != tierNone
+}
+
+// cachedResponse returns a cached response carrying the caller's id. Entries
+// produced by a backend below the caller's minimum block count as a miss, and
+// callers asking for a specific node version always miss.
+func (f *Forwarder) cachedResponse(r *http.Request, rt route, call *RPCRequest) (*upstreamResponse, bool) {
+	if consistencyFrom(r.Context()).nodeVersion != "" {
+		return nil, false
+	}
+	entry, ok := f.cache.Get(callKey(rt, call))
+	var (
+		block int
+		body  []byte
+	)
+	if ok {
+		block, body, ok = decodeEntry(entry)
+	}
+	if !ok || block < consistencyFrom(r.Context()).minBlock {
+		metrics.RecordCacheLookup(call.Method, "miss")
+		return nil, false
+	}
+	out, err := withID(body, call.responseID())
+	if err != nil {
+		return nil, false
+	}
+	metrics.RecordCacheLookup(call.Method, "hit")
+	return &upstreamResponse{
+		status: http.StatusOK,
+		header: http.Header{"Content-Type": []string{"application/json"}},
+		body:   out,
+		block:  block,
+	}, true
+}
+
+// encodeEntry prefixes a cached body with the block of the backend that
+// produced it, so hits can honour freshness constraints.
+func encodeEntry(block int, body []byte) []byte {
+	entry := strconv.AppendInt(nil, int64(block), 10)
+	entry = append(entry, '\n')
+	return append(entry, body...)
+}
+
+func decodeEntry(entry []byte) (int, []byte, bool) {
+	i := bytes.IndexByte(entry, '\n')
+	if i < 0 {
+		return 0, nil, false
+	}
+	block, err := strconv.Atoi(string(entry[:i]))
+	if err != nil {
+		return 0, nil, false
+	}
+	return block, entry[i+1:], true
+}
+
+// storeResponse caches a successful response according to the method's
+// policy. Final data at or below the finality tip is cached without a time
+// limit; everything else gets the short TTL and is tracked so it can be
+// evicted when the chain tips move.
+func (f *Forwarder) storeResponse(rt route, call *RPCRequest, resp *upstreamResponse) {
+	if resp.status != http.StatusOK || resp.pruned {
+		return
+	}
+	var rpcResp RPCResponse
+	if err := json.Unmarshal(resp.body, &rpcResp); err != nil || rpcResp.Error != nil {
+		return
+	}
+
+	key := callKey(rt, call)
+	entry := encodeEntry(resp.block, resp.body)
+	block := headBlock
+	if cachePolicies[call.Method] == tierImmutable && final(call, rpcResp.Result) {
+		if b, ok := dataBlock(call, rpcResp.Result); ok {
+			block = b
+			if tip := f.finalityTip(); tip > 0 && block <= tip {
+				f.cache.Set(key, entry, 0)
+				return
+			}
+		}
+	}
+
+	if f.cfg.CacheShortTTL <= 0 {
+		return
+	}
+	f.cache.Set(key, entry, f.cfg.CacheShortTTL)
+	f.unfinalized.track(key, block, time.Now().Add(f.cfg.CacheShortTTL))
+}
+
+// finalityTip returns the highest block treated as immutable, or 0 while no
+// chain tips are known.
+func (f *Forwarder) finalityTip() int {
+	tips := f.lb.ChainTips()
+	if f.cfg.CacheFinality == "proven" {
+		return tips.Proven
+	}
+	return tips.Finalized
+}
+
+// onChainTips evicts cached entries above the new finality tip, or every
+// unfinalized entry when a reorg was detected.
+func (f *Forwarder) onChainTips(prev, next ChainTips, reorg bool) {
+	if reorg && f.sessions != nil {
+		f.sessions.reset() // Observed blocks may no longer exist on any backend
+	}
+	if f.cache == nil {
+		return
+	}
+	tip := next.Finalized
+	if f.cfg.CacheFinality == "proven" {
+		tip = next.Proven
+	}
+	evicted := f.unfinalized.evict(f.cache.Delete, tip, reorg)
+	if reorg {
+		log.Warn().Int("latest", next.Latest).Int("previousLatest", prev.Latest).Int("evicted", evicted).Msg("Reorg detected, evicted unfinalized cache entries")
+	}
+}
+
+// unfinalizedIndex remembers which cached keys hold data above the finality
+// tip, and for which block. Keys leave the index with their cache entry, or
+// once their TTL has passed, so it stays bounded while the tips stand still.
+type unfinalizedIndex struct {
+	mu    sync.Mutex
+	keys  map[string]unfinalizedEntry
+	queue []trackedKey // In tracking order, which is expiry order as all entries share one TTL
+}
+
+type unfinalizedEntry struct {
+	block   int
+	expires time.Time
+}
+
+type trackedKey struct {
+	key     string
+	expires time.Time
+}
+
+func newUnfinalizedIndex() *unfinalizedIndex {
+	return &unfinalizedIndex{keys: make(map[string]unfinalizedEntry)}
+}
+
+func (u *unfinalizedIndex) track(key string, block int, expires time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.expire(time.Now())
+	u.keys[key] = unfinalizedEntry{block: block, expires: expires}
+	u.queue = append(u.queue, trackedKey{key: key, expires: expires})
+}
+
+// expire forgets keys whose TTL has passed. Caller holds u.mu.
+func (u *unfinalizedIndex) expire(now time.Time) {
+	for len(u.queue) > 0 && !u.queue[0].expires.After(now) {
+		t := u.queue[0]
+		if e, ok := u.keys[t.key]; ok && !e.expires.After(now) {
+			delete(u.keys, t.key) // Not tracked again since
+		}
+		u.queue[0] = trackedKey{}
+		u.queue = u.queue[1:]
+	}
+}
+
+// forget drops a key that left the cache.
+func (u *unfinalizedIndex) forget(key string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.keys, key)
+}
+
+// len returns the number of tracked keys.
+func (u *unfinalizedIndex) len() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.keys)
+}
+
+// evict deletes entries above tip (all entries when all is set) and forgets
+// entries that are now final. It returns the number of deleted entries.
+func (u *unfinalizedIndex) evict(del func(string), tip int, all bool) int {
+	u.mu.Lock()
+	var stale []string
+	for key, e := range u.keys {
+		if all || e.block > tip {
+			stale = append(stale, key)
+		}
+	}
+	u.keys = make(map[string]unfinalizedEntry)
+	u.queue = nil
+	u.mu.Unlock()
+
+	// Deleting calls back into forget, so the index must not be locked
+	for _, key := range stale {
+		del(key)
+	}
+	return len(stale)
+}
+
+// dataBlock returns the block an immutable-tier result belongs to.
+func dataBlock(call *RPCRequest, result json.RawMessage) (int, bool) {
+	switch call.Method {
+	case "node_getBlock", "node_getBlockHeader":
+		return paramInt(call.Params, 0)
+	case "node_getBlocks":
+		from, ok := paramInt(call.Params, 0)
+		limit, ok2 := paramInt(call.Params, 1)
+		if !ok || !ok2 || limit < 1 {
+			return 0, false
+		}
+		return from + limit - 1, true
+	case "node_getTxReceipt":
+		var receipt struct {
+			BlockNumber json.RawMessage `json:"blockNumber"`
+		}
+		if json.Unmarshal(result, &receipt) != nil {
+			return 0, false
+		}
+		return rawInt(receipt.BlockNumber)
+	case "node_getTxEffect":
+		var effect struct {
+			L2BlockNumber json.RawMessage `json:"l2BlockNumber"`
+		}
+		if json.Unmarshal(result, &effect) != nil {
+			return 0, false
+		}
+		return rawInt(effect.L2BlockNumber)
+	}
+	return 0, false
+}
+
+// final reports whether the result of an immutable-tier call can no longer change.
+func final(call *RPCRequest, result json.RawMessage) bool {
+	if len(result) == 0 || string(result) == "null" {
+		return false // Not produced yet
+	}
+
+	switch call.Method {
+	case "node_getBlock", "node_getBlockHeader":
+		// Only explicit block numbers; tags like "latest" move with the head
+		_, ok := paramInt(call.Params, 0)
+		return ok
+	case "node_getBlocks":
+		limit, ok := paramInt(call.Params, 1)
+		if !ok {
+			return false
+		}
+		var blocks []json.RawMessage
+		return json.Unmarshal(result, &blocks) == nil && len(blocks) == limit
+	case "node_getTxReceipt":
+		var receipt struct {
+			Status      string          `json:"status"`
+			BlockNumber json.RawMessage `json:"blockNumber"`
+		}
+		if err := json.Unmarshal(result, &receipt); err != nil {
+			return false
+		}
+		return !pendingReceiptStatuses[receipt.Status] && len(receipt.BlockNumber) > 0
+	}
+	return true
+}
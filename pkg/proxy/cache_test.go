@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarder_CachesImmutableResponses(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, `"result":{"number":5}`)
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withCache)
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+	lb.UpdateChainTips(ChainTips{Latest: 10, Proven: 8, Finalized: 8}, false)
+
+	first := forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":[5],"id":1}`)
+	second := forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":[5],"id":"second"}`)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":{"number":5},"id":1}`, first.Body.String())
+
+	var resp RPCResponse
+	assert.NoError(t, json.Unmarshal(second.Body.Bytes(), &resp))
+	assert.JSONEq(t, `"second"`, string(resp.ID), "cached responses carry the caller's id")
+	assert.JSONEq(t, `{"number":5}`, string(resp.Result))
+}
+
+func TestForwarder_DoesNotCacheUnfinalizedData(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, `"result":{"status":"pending","txHash":"0x01"}`)
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withCache) // No short TTL: only final data is cached
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getTxReceipt","params":["0x01"],"id":1}`)
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getTxReceipt","params":["0x01"],"id":2}`)
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":["latest"],"id":3}`)
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":["latest"],"id":4}`)
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+}
+
+func TestForwarder_DoesNotCacheErrors(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, `"error":{"code":-32603,"message":"internal"}`)
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withCache)
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":[1],"id":1}`)
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":[1],"id":1}`)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestForwarder_EvictsUnfinalizedOnTipsMove(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, `"result":{"number":9}`)
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withCache)
+	cfg.CacheShortTTL = time.Minute
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+	lb.UpdateChainTips(ChainTips{Latest: 10, Proven: 8, Finalized: 8}, false)
+
+	final := `{"jsonrpc":"2.0","method":"node_getBlock","params":[8],"id":1}`
+	unfinalized := `{"jsonrpc":"2.0","method":"node_getBlock","params":[9],"id":1}`
+
+	forwardCall(f, final)
+	forwardCall(f, unfinalized)
+	forwardCall(f, final)
+	forwardCall(f, unfinalized)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits), "both blocks are cached")
+
+	// New head: block 9 is still above the finalized tip and is evicted
+	lb.UpdateChainTips(ChainTips{Latest: 11, Proven: 8, Finalized: 8}, false)
+	forwardCall(f, final)
+	forwardCall(f, unfinalized)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+	// Reorg evicts everything unfinalized but keeps finalized blocks
+	lb.UpdateChainTips(ChainTips{Latest: 11, LatestHash: "0xnew", Proven: 8, Finalized: 8}, true)
+	forwardCall(f, final)
+	forwardCall(f, unfinalized)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+}
+
+func TestForwarder_UnfinalizedIndexBoundedWithoutTips(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, `"result":{"number":9}`)
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withCache)
+	cfg.CacheMaxBytes = 2048
+	cfg.CacheShortTTL = 50 * time.Millisecond
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+	block := func(n int) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","method":"node_getBlock","params":[%d],"id":1}`, n)
+	}
+
+	// No tip update ever arrives: LRU eviction still takes keys out of the index
+	for n := 0; n < 200; n++ {
+		forwardCall(f, block(n))
+	}
+	assert.Less(t, f.cache.Len(), 200, "the cache should have evicted entries")
+	assert.LessOrEqual(t, f.unfinalized.len(), f.cache.Len())
+
+	// Deleted entries leave the index
+	last, _ := ParseRPCRequest([]byte(block(199)))
+	f.cache.Delete(callKey(defaultRoute, last))
+	assert.LessOrEqual(t, f.unfinalized.len(), f.cache.Len())
+
+	// Expired entries leave the index even if the cache still holds them
+	time.Sleep(cfg.CacheShortTTL)
+	forwardCall(f, block(1000))
+	assert.Equal(t, 1, f.unfinalized.len())
+}
+
+func TestForwarder_ImmutableRequiresKnownTips(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, `"result":{"number":5}`)
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withCache) // No short TTL and no tips: nothing can be cached safely
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":[5],"id":1}`)
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":[5],"id":1}`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// rpcCodeMethodNotFound is the JSON-RPC error code for unknown methods.
+const rpcCodeMethodNotFound = -32601
+
+// maxUnsupportedMethods caps the methods live traffic can mark unsupported on
+// one backend; the capability prober rechecks every one of them.
+const maxUnsupportedMethods = 64
+
+// SetUnsupportedMethods replaces the set of methods a backend is known not to
+// serve. Caller holds lb.mu, e.g. through UpdateBackendStateByUrl.
+func (b *Backend) SetUnsupportedMethods(methods map[string]bool) {
+	b.UnsupportedMethods = methods
+	metrics.SetBackendUnsupportedMethods(b.URL, len(methods))
+}
+
+// MarkMethodUnsupported stops routing method to the backend with the URL of
+// b after it answered "method not found". It reports whether the method was
+// newly marked; once a backend has maxUnsupportedMethods marks, no more are added.
+func (lb *LoadBalancer) MarkMethodUnsupported(b *Backend, method string) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	b = lb.lookup(b.URL)
+	if b == nil || b.UnsupportedMethods[method] || len(b.UnsupportedMethods) >= maxUnsupportedMethods {
+		return false
+	}
+
+	// Copy on write: the map is shared with the published view
+	methods := make(map[string]bool, len(b.UnsupportedMethods)+1)
+	for m := range b.UnsupportedMethods {
+		methods[m] = true
+	}
+	methods[method] = true
+	b.SetUnsupportedMethods(methods)
+	lb.publish()
+	log.Warn().Str("url", b.URL).Str("method", method).Msg("Backend does not support method, no longer routing it there")
+	return true
+}
+
+// MethodUnsupported reports whether backends could serve c if it did not name
+// a method, but every one of them is known not to support it. Backends
+// already tried for the request are not ruled out.
+func (lb *LoadBalancer) MethodUnsupported(c Criteria) bool {
+	if c.Method == "" {
+		return false
+	}
+	c.Exclude = nil
+	loose := c
+	loose.Method = ""
+	return !lb.available(c) && lb.available(loose)
+}
+
+// markUnsupported checks a backend response for a "method not found" error
+// and records it. It reports whether the call should go to another backend.
+// Only probed methods and methods another backend has served are recorded:
+// any other name is the client's mistake and its error is relayed as-is.
+func (f *Forwarder) markUnsupported(method string, b *Backend, resp *upstreamResponse) bool {
+	if b == nil || resp.rpcErr == nil || resp.rpcErr.Code != rpcCodeMethodNotFound {
+		return false
+	}
+	if !f.probedMethods[method] && (method == metrics.OtherMethod || metrics.MethodLabel(method) != method) {
+		return false
+	}
+	return f.lb.MarkMethodUnsupported(b, method)
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+)
+
+// coalescer collapses identical in-flight calls into a single backend request
+// whose response is shared with every waiting caller.
+type coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+	methods map[string]bool // Read-only methods that may be coalesced
+}
+
+type flight struct {
+	done    chan struct{}
+	resp    *upstreamResponse
+	backend *Backend
+	err     error
+}
+
+func newCoalescer(methods []string) *coalescer {
+	c := &coalescer{flights: make(map[string]*flight), methods: make(map[string]bool)}
+	for _, m := range methods {
+		c.methods[m] = true
+	}
+	return c
+}
+
+// coalescable reports whether call may share a backend response with
+// identical concurrent calls. Only listed read-only methods qualify, so
+// unknown and state-changing calls always reach a backend on their own.
+func (f *Forwarder) coalescable(call *RPCRequest) bool {
+	return f.cfg.CoalesceEnabled && !call.IsNotification() && f.coalescer.methods[call.Method] && f.retry.replaySafe(call.Method)
+}
+
+// do runs fn once for all concurrent callers sharing key. The shared call runs
+// in its own goroutine, so every caller, the one that started it included,
+// stops waiting when its own context ends while the call keeps running for the
+// others. The returned bool reports whether the result came from another caller.
+func (c *coalescer) do(ctx context.Context, key string, fn func() (*upstreamResponse, *Backend, error)) (*upstreamResponse, *Backend, error, bool) {
+	c.mu.Lock()
+	fl, shared := c.flights[key]
+	if !shared {
+		fl = &flight{done: make(chan struct{})}
+		c.flights[key] = fl
+		go c.run(key, fl, fn)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-fl.done:
+		return fl.resp, fl.backend, fl.err, shared
+	case <-ctx.Done():
+		return nil, nil, ctx.Err(), shared
+	}
+}
+
+// run executes the shared call of fl and releases its waiters.
+func (c *coalescer) run(key string, fl *flight, fn func() (*upstreamResponse, *Backend, error)) {
+	fl.resp, fl.backend, fl.err = fn()
+
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(fl.done)
+}
+
+// callKey identifies a call by route, method and canonicalised params,
+// ignoring the JSON-RPC id.
+func callKey(rt route, call *RPCRequest) string {
+	return rt.nodeType + "|" + call.Method + "|" + canonicalJSON(call.Params)
+}
+
+// requestKey identifies what a shared call forwards on behalf of its caller
+// besides the body: the query string and the forwarded headers. Callers only
+// share a response when the leader's request is the one they would have sent.
+func requestKey(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString("|query:")
+	b.WriteString(r.URL.RawQuery)
+
+	names := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if k == "Accept-Encoding" || isHopHeader(k) {
+			continue // Not forwarded
+		}
+		for _, v := range r.Header[k] {
+			b.WriteString("|")
+			b.WriteString(k)
+			b.WriteString(":")
+			b.WriteString(v)
+		}
+	}
+	return digest(b.String())
+}
+
+// canonicalJSON re-encodes raw JSON with sorted object keys and no
+// insignificant whitespace. Invalid JSON is returned unchanged.
+func canonicalJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return string(raw)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return string(raw)
+	}
+	return string(out)
+}
+
+// coalesce executes call through the coalescer, restoring the caller's own id on shared responses.
+func (f *Forwarder) coalesce(r *http.Request, rt route, call *RPCRequest, body []byte) (*upstreamResponse, *Backend, error) {
+	// The shared call must outlive any one client disconnecting, the leader's included
+	detached := r.WithContext(context.WithoutCancel(r.Context()))
+	key := callKey(rt, call) + consistencyFrom(r.Context()).flightKey() + "|" + requestKey(r)
+	resp, backend, err, shared := f.coalescer.do(r.Context(), key, func() (*upstreamResponse, *Backend, error) {
+		return f.execute(detached, rt, call.Method, body)
+	})
+
+	role := "leader"
+	if shared {
+		role = "follower"
+	}
+	metrics.RecordCoalesce(call.Method, role)
+
+	if !shared || err != nil {
+		return resp, backend, err
+	}
+
+	out, idErr := withID(resp.body, call.responseID())
+	if idErr != nil {
+		return resp, backend, err // Not a JSON-RPC object; share as-is
+	}
+	return &upstreamResponse{status: resp.status, header: resp.header, body: out, block: resp.block, rpcErr: resp.rpcErr, rpcClass: resp.rpcClass, pruned: resp.pruned}, backend, nil
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarder_CoalescesIdenticalReads(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(200 * time.Millisecond)
+		body, _ := io.ReadAll(r.Body)
+		call, _ := ParseRPCRequest(body)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":12345,"id":` + string(call.ID) + `}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backend.URL}, CoalesceEnabled: true, CoalesceMethods: []string{"node_getBlockNumber"}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	const clients = 20
+	var wg sync.WaitGroup
+	bodies := make([]string, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[],"id":%d}`, i+1)
+			w := httptest.NewRecorder()
+			f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+			bodies[i] = w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "identical reads should share one backend call")
+	for i, body := range bodies {
+		var resp RPCResponse
+		assert.NoError(t, json.Unmarshal([]byte(body), &resp))
+		assert.JSONEq(t, "12345", string(resp.Result))
+		assert.JSONEq(t, fmt.Sprint(i+1), string(resp.ID), "every caller gets its own id back")
+	}
+}
+
+func TestForwarder_DoesNotCoalesceWrites(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":null,"id":1}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		SentinelBackends:     []string{backend.URL},
+		CoalesceEnabled:      true,
+		CoalesceMethods:      []string{"node_getBlockNumber"},
+		RetryExcludedMethods: []string{"node_sendTx"},
+	}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Forward(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_sendTx","params":["0x01"],"id":1}`)))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(5), atomic.LoadInt32(&hits))
+}
+
+func TestForwarder_CoalescesOnlyListedMethods(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":true,"id":1}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backend.URL}, CoalesceEnabled: true, CoalesceMethods: []string{"node_getBlockNumber"}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Forward(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"admin_setConfig","params":[{"key":1}],"id":1}`)))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(5), atomic.LoadInt32(&hits), "unlisted methods may change state and must not share a response")
+}
+
+func TestForwarder_CoalescesOnlyMatchingRequests(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"` + r.Header.Get("Authorization") + r.URL.RawQuery + `","id":1}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backend.URL}, CoalesceEnabled: true, CoalesceMethods: []string{"node_getBlockNumber"}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+	body := `{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[],"id":1}`
+
+	requests := []struct{ target, auth, want string }{
+		{"/", "alice", "alice"},
+		{"/", "bob", "bob"},
+		{"/?key=1", "alice", "alicekey=1"},
+	}
+	var wg sync.WaitGroup
+	for _, req := range requests {
+		wg.Add(1)
+		go func(target, auth, want string) {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", target, strings.NewReader(body))
+			r.Header.Set("Authorization", auth)
+			w := httptest.NewRecorder()
+			f.Forward(w, r)
+			assert.Contains(t, w.Body.String(), `"result":"`+want+`"`, "every caller gets the response to its own request")
+		}(req.target, req.auth, req.want)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits), "calls with different headers or query strings must not share a backend request")
+}
+
+func TestCallKey_IgnoresIDAndFormatting(t *testing.T) {
+	a, _ := ParseRPCRequest([]byte(`{"jsonrpc":"2.0","method":"node_getPublicLogs","params":[{"toBlock":20,"fromBlock":10}],"id":1}`))
+	b, _ := ParseRPCRequest([]byte(`{"jsonrpc":"2.0","method":"node_getPublicLogs","params":[ { "fromBlock": 10, "toBlock": 20 } ],"id":"x"}`))
+	c, _ := ParseRPCRequest([]byte(`{"jsonrpc":"2.0","method":"node_getPublicLogs","params":[{"fromBlock":10,"toBlock":21}],"id":1}`))
+
+	assert.Equal(t, callKey(defaultRoute, a), callKey(defaultRoute, b))
+	assert.NotEqual(t, callKey(defaultRoute, a), callKey(defaultRoute, c))
+	assert.NotEqual(t, callKey(defaultRoute, a), callKey(archiverRoute, a))
+}
+
+func TestForwarder_CoalesceLeaderReturnsOnDisconnect(t *testing.T) {
+	release := make(chan struct{})
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte(`{"jsonrpc":"2.0","result":7,"id":1}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backend.URL}, CoalesceEnabled: true, CoalesceMethods: []string{"node_getBlockNumber"}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+	body := `{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[],"id":1}`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		f.Forward(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)).WithContext(ctx))
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 1 }, time.Second, time.Millisecond)
+
+	followerBody := make(chan string)
+	go func() {
+		w := httptest.NewRecorder()
+		f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		followerBody <- w.Body.String()
+	}()
+
+	cancel()
+	select {
+	case <-leaderDone:
+	case <-time.After(time.Second):
+		t.Fatal("leader should return as soon as its client disconnects")
+	}
+
+	time.Sleep(20 * time.Millisecond) // Let the follower join the flight
+	close(release)
+	assert.Contains(t, <-followerBody, `"result":7`, "the shared call keeps running for the followers")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
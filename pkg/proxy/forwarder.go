@@ -1,109 +1,470 @@
 package proxy
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/cache"
 	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
 	"github.com/rs/zerolog/log"
 )
 
 // Forwarder handles request forwarding to backends
 type Forwarder struct {
-	cfg *config.Config
-	lb  *LoadBalancer
+	cfg           *config.Config
+	lb            *LoadBalancer
+	client        *http.Client
+	retry         *retryPolicy
+	hedge         *hedgePolicy
+	rpcErrors     *rpcErrorPolicy
+	probedMethods map[string]bool // Methods the capability prober checks on every backend
+	coalescer     *coalescer
+	cache         cache.Cache
+	unfinalized   *unfinalizedIndex
+	sessions      *sessionStore
+}
+
+var (
+	errNoBackend          = errors.New("no backend available")
+	errRangeUnavailable   = errors.New("block range unavailable")
+	errMethodNotSupported = errors.New("method not supported")
+)
+
+// rangeUnavailableMessage is the error returned when no backend retains the
+// blocks or slots a call names.
+const rangeUnavailableMessage = "Block range unavailable: no healthy backend retains the requested blocks or slots"
+
+// methodNotSupportedMessage is the error returned when every backend that
+// could take a call is known not to serve its method.
+const methodNotSupportedMessage = "Method not found: no healthy backend supports the method"
+
+// route describes the backend pool served by a Forwarder entrypoint.
+type route struct {
+	nodeType    string // Required node type, empty for any healthy backend
+	unavailable string // Error message when no backend is available
+}
+
+var (
+	defaultRoute  = route{unavailable: "No healthy backends available"}
+	archiverRoute = route{nodeType: "archiver", unavailable: "No healthy archiver backend available"}
+	prunedRoute   = route{nodeType: "pruned", unavailable: "No healthy pruned backends available"}
+)
+
+// historyMethods need the long validator history only archivers retain.
+var historyMethods = map[string]bool{
+	"node_getValidatorsStats": true,
+	"node_getValidatorStats":  true,
 }
 
 func NewRequestForwarder(cfg *config.Config, lb *LoadBalancer) *Forwarder {
-	return &Forwarder{
+	var responseCache cache.Cache
+	if cfg.CacheEnabled {
+		responseCache = cache.NewMemory(int64(cfg.CacheMaxBytes))
+	}
+	probedMethods := make(map[string]bool)
+	for _, m := range cfg.CapabilityProbeMethods {
+		probedMethods[m] = true
+	}
+	f := &Forwarder{
 		cfg: cfg,
 		lb:  lb,
+		client: &http.Client{
+			Timeout: cfg.RequestTimeout,
+		},
+		retry:         newRetryPolicy(cfg),
+		hedge:         newHedgePolicy(cfg),
+		rpcErrors:     newRPCErrorPolicy(cfg),
+		probedMethods: probedMethods,
+		coalescer:     newCoalescer(cfg.CoalesceMethods),
+		unfinalized:   newUnfinalizedIndex(),
+	}
+	f.setCache(responseCache)
+	if cfg.SessionEnabled {
+		f.sessions = newSessionStore(cfg.SessionTTL, cfg.SessionMaxEntries)
+	}
+	lb.OnChainTips(f.onChainTips)
+	return f
+}
+
+// WithCache replaces the response cache, e.g. with a shared store. A nil
+// cache disables response caching.
+func (f *Forwarder) WithCache(c cache.Cache) *Forwarder {
+	f.setCache(c)
+	return f
+}
+
+// setCache installs the response cache, keeping the unfinalized index in step
+// with entries the cache drops on its own.
+func (f *Forwarder) setCache(c cache.Cache) {
+	f.cache = c
+	if n, ok := c.(cache.EvictNotifier); ok {
+		n.OnEvict(f.unfinalized.forget)
 	}
 }
 
 // Forward forwards the request to any healthy backend
 func (f *Forwarder) Forward(w http.ResponseWriter, r *http.Request) {
-	backend := f.lb.GetNextBackend()
-	if backend == nil {
-		metrics.RequestTotal.WithLabelValues("proxy", "503", "none").Inc()
-		http.Error(w, "No healthy backends available", http.StatusServiceUnavailable)
-		return
-	}
-	f.forward(w, r, backend)
+	f.serve(w, r, defaultRoute)
 }
 
 // ForwardArchiver forwards the request to an archiver backend
 func (f *Forwarder) ForwardArchiver(w http.ResponseWriter, r *http.Request) {
-	backend := f.lb.GetArchiverBackend()
-	if backend == nil {
-		http.Error(w, "No healthy archiver backend available", http.StatusServiceUnavailable)
-		return
-	}
-	r.URL.Path = "/"
-	f.forward(w, r, backend)
+	f.serve(w, r, archiverRoute)
 }
 
 // ForwardPruned forwards the request to a pruned backend
 func (f *Forwarder) ForwardPruned(w http.ResponseWriter, r *http.Request) {
-	backend := f.lb.GetPrunedBackend()
-	if backend == nil {
-		http.Error(w, "No healthy pruned backends available", http.StatusServiceUnavailable)
+	f.serve(w, r, prunedRoute)
+}
+
+func (f *Forwarder) serve(w http.ResponseWriter, r *http.Request, rt route) {
+	r, body, ok := f.decode(w, r)
+	if !ok {
 		return
 	}
-	r.URL.Path = "/"
-	f.forward(w, r, backend)
-}
+	call := RPCRequestFromContext(r.Context())
 
-// forward contains the actual reverse proxy logic
-func (f *Forwarder) forward(w http.ResponseWriter, r *http.Request, b *Backend) {
-	targetURL := b.URL
-	target, err := url.Parse(targetURL)
+	cons, err := f.parseConsistency(r)
 	if err != nil {
-		log.Error().Err(err).Str("url", targetURL).Msg("Failed to parse target URL")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeRPCError(w, http.StatusBadRequest, call.responseID(), RPCCodeInvalidRequest, err.Error())
+		return
+	}
+	f.joinSession(r, cons)
+	r = r.WithContext(withConsistency(r.Context(), cons))
+
+	if batch := RPCBatchFromContext(r.Context()); batch != nil {
+		f.forwardBatch(w, r, rt, batch)
 		return
 	}
 
-	// Prometheus metric
+	resp, _, err := f.dispatch(r, rt, call, body)
+	switch {
+	case err == errNoBackend && cons.constrained():
+		writeRPCError(w, http.StatusServiceUnavailable, call.responseID(), RPCCodeNoBackend, unavailableMessage(r, rt))
+	case err == errRangeUnavailable:
+		writeRPCError(w, http.StatusServiceUnavailable, call.responseID(), RPCCodeRangeUnavailable, rangeUnavailableMessage)
+	case err == errMethodNotSupported:
+		writeRPCError(w, http.StatusOK, call.responseID(), rpcCodeMethodNotFound, methodNotSupportedMessage)
+	case err == errNoBackend:
+		if rt.nodeType == "" {
+			metrics.RecordRequest(methodOf(r.Context()), "503", "none")
+		}
+		http.Error(w, rt.unavailable, http.StatusServiceUnavailable)
+	case err != nil:
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	default:
+		f.observeBlock(r, resp.block)
+		setBackendBlock(w, resp.block)
+		writeUpstream(w, resp)
+	}
+}
+
+// dispatch serves a single call from the response cache when possible,
+// otherwise collapsing identical concurrent read-only calls into one backend
+// request. Opaque bodies (nil call) are executed directly.
+func (f *Forwarder) dispatch(r *http.Request, rt route, call *RPCRequest, body []byte) (*upstreamResponse, *Backend, error) {
+	if call == nil {
+		return f.execute(r, rt, "unknown", body)
+	}
+
+	cacheable := f.cacheable(call)
+	if cacheable {
+		if resp, ok := f.cachedResponse(r, rt, call); ok {
+			return resp, nil, nil
+		}
+	}
+
+	var (
+		resp    *upstreamResponse
+		backend *Backend
+		err     error
+	)
+	if f.coalescable(call) {
+		resp, backend, err = f.coalesce(r, rt, call, body)
+	} else {
+		resp, backend, err = f.execute(r, rt, call.Method, body)
+	}
+	if cacheable && err == nil {
+		f.storeResponse(rt, call, resp)
+	}
+	return resp, backend, err
+}
+
+// execute sends body to a backend chosen for the route. Retryable failures
+// are retried on a different backend while the attempt limit and the global
+// retry budget allow it, backend-class JSON-RPC errors only once; the last
+// response or error is returned. Calls to a method no backend supports fail
+// with errMethodNotSupported, calls naming blocks or slots no backend retains
+// with errRangeUnavailable.
+func (f *Forwarder) execute(r *http.Request, rt route, method string, body []byte) (*upstreamResponse, *Backend, error) {
+	c := f.criteria(r, rt, method)
+	maxAttempts := 1
+	if f.retry.allows(method) {
+		maxAttempts = f.retry.maxAttempts
+	}
+	f.retry.budget.deposit()
+
+	var (
+		resp       *upstreamResponse
+		backend    *Backend
+		err        error
+		failedOver bool // A backend-class JSON-RPC error was already failed over
+	)
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		b := f.lb.Select(c)
+		if b == nil {
+			if attempt == 1 {
+				if f.lb.MethodUnsupported(c) {
+					return nil, nil, errMethodNotSupported
+				}
+				if f.lb.RangeUnavailable(c) {
+					return nil, nil, errRangeUnavailable
+				}
+				return nil, nil, errNoBackend
+			}
+			break
+		}
+
+		if attempt > 1 {
+			if !f.retry.budget.withdraw() {
+				metrics.RecordRetry("budget_exhausted")
+				b.breaker.release()
+				break
+			}
+			if !sleepContext(r.Context(), f.retry.backoff(attempt-1)) {
+				b.breaker.release()
+				break
+			}
+			metrics.RecordRetry("attempted")
+			log.Debug().Str("method", method).Str("from", backend.URL).Str("to", b.URL).Int("attempt", attempt).Msg("Retrying request on another backend")
+		}
+
+		resp, backend, err = f.send(r, c, b, body)
+		unsupported := err == nil && f.markUnsupported(method, backend, resp)
+		pruned := err == nil && f.markPruned(r, backend, resp)
+		failover := !failedOver && backendError(r.Context(), resp, err)
+		if !unsupported && !pruned && !failover && !retryable(r.Context(), resp, err) {
+			break
+		}
+		failedOver = failedOver || failover
+		c.Exclude = excludeURL(excludeURL(c.Exclude, b.URL), backend.URL)
+	}
+	if err == nil && resp.pruned && f.lb.RangeUnavailable(c) {
+		return nil, nil, errRangeUnavailable // Every backend retaining the range is gone
+	}
+	return resp, backend, err
+}
+
+// criteria builds the backend selection criteria for a call on a route.
+func (f *Forwarder) criteria(r *http.Request, rt route, method string) Criteria {
+	cons := consistencyFrom(r.Context())
+	c := Criteria{
+		NodeType:    rt.nodeType,
+		Method:      method,
+		MinBlock:    cons.minBlock,
+		NodeVersion: cons.nodeVersion,
+	}
+	c.Key = cons.session
+	if call := RPCRequestFromContext(r.Context()); call != nil {
+		if c.Key == "" {
+			c.Key = call.Method + "|" + string(call.Params)
+		}
+		if s, ok := blockSpan(call); ok {
+			// Ranges reaching past the head only need what exists so far
+			if best := f.lb.BestBlock(); best > 0 && s.To > best {
+				s.To = best
+			}
+			c.Blocks = s
+		}
+		c.Slots, _ = slotSpan(call)
+	}
+	if rt.nodeType == "" && historyMethods[method] && c.Slots == nil {
+		c.PreferNodeType = "archiver"
+	}
+	return c
+}
+
+// decode reads the request body once, attaches the decoded JSON-RPC envelope
+// to the request context and returns the buffered body for forwarding.
+// Bodies that are not a JSON-RPC call are forwarded as-is.
+func (f *Forwarder) decode(w http.ResponseWriter, r *http.Request) (*http.Request, []byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, nil, true
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBodyBytes))
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, "Request body too large or unreadable", http.StatusRequestEntityTooLarge)
+		return r, nil, false
+	}
+
+	if rpcReq, err := ParseRPCRequest(body); err == nil {
+		r = r.WithContext(WithRPCRequest(r.Context(), rpcReq))
+	} else if batch, err := ParseRPCBatch(body); err == nil {
+		r = r.WithContext(WithRPCBatch(r.Context(), batch))
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return r, body, true
+}
+
+// upstreamResponse is a fully buffered backend response.
+type upstreamResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	block    int       // Block of the serving backend when the response was produced
+	rpcErr   *RPCError // Error object of a single JSON-RPC response, nil if none
+	rpcClass string    // Class of rpcErr, empty if none
+	pruned   bool      // Null for a block the backend no longer retains
+}
+
+// roundTrip sends body to backend b and buffers the response. The request
+// provides the context and JSON-RPC envelope used for logging. Every call
+// either reports an outcome to b's circuit breaker or releases the trial
+// slot Select took for it.
+func (f *Forwarder) roundTrip(r *http.Request, b *Backend, body []byte) (*upstreamResponse, error) {
+	method := methodOf(r.Context())
 	start := time.Now()
 	defer func() {
-		metrics.ObserveRequestDuration("proxy", b.URL, time.Since(start).Seconds())
+		metrics.ObserveRequestDuration(method, b.URL, time.Since(start).Seconds())
 	}()
 
-	proxy := httputil.NewSingleHostReverseProxy(target)
+	target := b.URL
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		b.breaker.release()
+		return nil, err
+	}
+	copyHeader(req.Header, r.Header)
+	setForwardedHeaders(req.Header, r)
+	req.Header.Del("Accept-Encoding") // Let the transport negotiate and decode compression
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	b.load.begin()
+	defer b.load.end()
 
-	// Customize the Director to set the Host header correctly
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		req.Host = target.Host
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if r.Context().Err() != nil {
+			b.breaker.release()
+			return nil, err // Cancelled by the client or a winning hedge, not a backend fault
+		}
+		f.lb.IncErrorRequest(b)
+		metrics.RecordTransportError(method, b.URL)
+		log.Error().Err(err).Str("target", b.URL).Str("method", method).Msg("Proxy error")
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// Error handling
-	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if r.Context().Err() != nil {
+			b.breaker.release()
+			return nil, err
+		}
 		f.lb.IncErrorRequest(b)
+		metrics.RecordTransportError(method, b.URL)
+		log.Error().Err(err).Str("target", b.URL).Str("method", method).Msg("Failed to read backend response")
+		return nil, err
+	}
 
-		log.Error().Err(err).Str("target", targetURL).Msg("Proxy error")
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	latency := time.Since(start)
+	rpcErr := responseError(respBody)
+	class := f.rpcErrors.classify(rpcErr)
+	if resp.StatusCode == http.StatusOK && (rpcErr == nil || rpcErr.Code != rpcCodeMethodNotFound) {
+		metrics.LearnMethod(method) // A backend serves it
+	}
+	if backendFault(class) {
+		f.lb.IncErrorRequest(b)
+		log.Debug().Str("target", b.URL).Str("method", method).Int("code", rpcErr.Code).Str("class", class).Str("error", rpcErr.Message).Msg("Backend answered with a JSON-RPC error")
+	} else {
+		f.lb.IncSuccessfulRequest(b, resp.StatusCode, latency)
+		if resp.StatusCode == http.StatusOK && rpcErr == nil {
+			f.lb.RecordMethodLatency(method, latency)
+		}
+	}
+	metrics.RecordRequest(method, strconv.Itoa(resp.StatusCode), b.URL)
+	if rpcErr != nil {
+		metrics.RecordRPCError(method, rpcErr.Code, class, b.URL)
 	}
+	return &upstreamResponse{status: resp.StatusCode, header: resp.Header, body: respBody, block: f.lb.BlockOf(b), rpcErr: rpcErr, rpcClass: class}, nil
+}
 
-	// Modify response to track success
-	rw := &statusResponseWriter{ResponseWriter: w, status: 200}
-	proxy.ServeHTTP(rw, r)
+// writeUpstream relays a buffered backend response to the client.
+func writeUpstream(w http.ResponseWriter, resp *upstreamResponse) {
+	copyHeader(w.Header(), resp.header)
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
 
-	// Record the request status (count as success from LB connection perspective)
-	f.lb.IncSuccessfulRequest(b, rw.status, time.Since(start))
+// Hop-by-hop headers are not forwarded between client and backend.
+var hopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// setForwardedHeaders tells the backend who the client is: the client IP is
+// appended to X-Forwarded-For, and X-Forwarded-Host and X-Forwarded-Proto
+// describe the client's request unless a proxy in front already set them.
+func setForwardedHeaders(h http.Header, r *http.Request) {
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := h.Values("X-Forwarded-For"); len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		h.Set("X-Forwarded-For", ip)
+	}
+	if h.Get("X-Forwarded-Host") == "" && r.Host != "" {
+		h.Set("X-Forwarded-Host", r.Host)
+	}
+	if h.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if r.TLS != nil {
+			proto = "https"
+		}
+		h.Set("X-Forwarded-Proto", proto)
+	}
 }
 
-type statusResponseWriter struct {
-	http.ResponseWriter
-	status int
+// isHopHeader reports whether the canonical header name k is hop-by-hop.
+func isHopHeader(k string) bool {
+	for _, h := range hopHeaders {
+		if h == k {
+			return true
+		}
+	}
+	return false
 }
 
-func (w *statusResponseWriter) WriteHeader(code int) {
-	w.status = code
-	w.ResponseWriter.WriteHeader(code)
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+	for _, h := range hopHeaders {
+		dst.Del(h)
+	}
 }
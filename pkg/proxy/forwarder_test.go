@@ -1,12 +1,17 @@
 package proxy
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,10 +47,44 @@ func TestForwarder_Forward(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
 	// Check Backend Stats
-	backends := lb.GetBackends()
+	backends := lb.Snapshot().Backends
 	assert.Equal(t, int64(1), backends[0].RequestStats.TotalRequests)
 }
 
+func TestForwarder_SetsForwardedHeaders(t *testing.T) {
+	headers := make(chan http.Header, 2)
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.Write([]byte(`{"jsonrpc":"2.0","result":1,"id":1}`))
+	}))
+	defer backendServer.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backendServer.URL}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	req := httptest.NewRequest("POST", "http://rpc.example/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlockNumber","id":1}`))
+	req.RemoteAddr = "203.0.113.7:4711"
+	f.Forward(httptest.NewRecorder(), req)
+
+	h := <-headers
+	assert.Equal(t, "203.0.113.7", h.Get("X-Forwarded-For"))
+	assert.Equal(t, "rpc.example", h.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", h.Get("X-Forwarded-Proto"))
+
+	// Behind another proxy the client IP is appended and its forwarding headers kept
+	req = httptest.NewRequest("POST", "http://internal/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlockNumber","id":1}`))
+	req.RemoteAddr = "10.0.0.2:4711"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Forwarded-Host", "rpc.example")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	f.Forward(httptest.NewRecorder(), req)
+
+	h = <-headers
+	assert.Equal(t, "203.0.113.7, 10.0.0.2", h.Get("X-Forwarded-For"))
+	assert.Equal(t, "rpc.example", h.Get("X-Forwarded-Host"))
+	assert.Equal(t, "https", h.Get("X-Forwarded-Proto"))
+}
+
 func TestForwarder_ForwardArchiver(t *testing.T) {
 	// Setup mock backends
 	archiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -140,3 +179,122 @@ func TestForwarder_NoHealthyBackend(t *testing.T) {
 
 	assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
 }
+
+func TestForwarder_DecodesJSONRPCEnvelope(t *testing.T) {
+	body := `{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[],"id":7}`
+
+	var received string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":1,"id":7}`))
+	}))
+	defer backendServer.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backendServer.URL}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	decoded, _, ok := f.decode(httptest.NewRecorder(), req)
+	assert.True(t, ok)
+
+	rpcReq := RPCRequestFromContext(decoded.Context())
+	if assert.NotNil(t, rpcReq) {
+		assert.Equal(t, "node_getBlockNumber", rpcReq.Method)
+		assert.JSONEq(t, "7", string(rpcReq.ID))
+	}
+
+	// The body must still reach the backend untouched
+	w := httptest.NewRecorder()
+	f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, body, received)
+}
+
+func TestParseRPCRequest_Opaque(t *testing.T) {
+	_, err := ParseRPCRequest([]byte("not json"))
+	assert.Error(t, err)
+
+	_, err = ParseRPCRequest([]byte(`{"jsonrpc":"2.0","id":1}`))
+	assert.Error(t, err, "a call without a method is not a JSON-RPC request")
+}
+
+func TestForwarder_MethodMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "node_getBlockNumber"):
+			w.Write([]byte(`{"jsonrpc":"2.0","result":7,"id":1}`))
+		case strings.Contains(string(body), "node_getTxReceipt"):
+			w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":1}`))
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":1}`))
+		}
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backend.URL}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+	call := func(method string) {
+		f.Forward(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"`+method+`","id":1}`)))
+	}
+
+	call("node_getBlockNumber")
+	call("node_getTxReceipt")
+	call("evil_randomName")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RequestTotal.WithLabelValues("node_getBlockNumber", "200", backend.URL)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RequestTotal.WithLabelValues("node_getTxReceipt", "200", backend.URL)), "an RPC error still proves the method exists")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RequestTotal.WithLabelValues(metrics.OtherMethod, "200", backend.URL)), "methods no backend serves are folded")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RPCErrorTotal.WithLabelValues("node_getTxReceipt", "-32602", RPCErrorClient, backend.URL)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RPCErrorTotal.WithLabelValues(metrics.OtherMethod, "-32601", RPCErrorClient, backend.URL)))
+	assert.Zero(t, testutil.ToFloat64(metrics.TransportErrorTotal.WithLabelValues("node_getTxReceipt", backend.URL)))
+}
+
+func TestForwarder_TransportErrorMetrics(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{down.URL}}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+	f.Forward(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlockNumber","id":1}`)))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.TransportErrorTotal.WithLabelValues("node_getBlockNumber", down.URL)))
+	assert.Zero(t, testutil.ToFloat64(metrics.RequestTotal.WithLabelValues("node_getBlockNumber", "502", down.URL)), "no response, no status")
+}
+
+func TestForwarder_MethodStatsBounded(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "node_getBlockNumber") {
+			w.Write([]byte(`{"jsonrpc":"2.0","result":7,"id":1}`))
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":1}`))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{backend.URL}}
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+	call := func(method string) {
+		f.Forward(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"`+method+`","id":1}`)))
+	}
+
+	call("node_getBlockNumber")
+	for i := 0; i < 50; i++ {
+		call(fmt.Sprintf("evil_method%d", i))
+	}
+
+	methods := lb.Snapshot().Methods
+	assert.Len(t, methods, 1, "made-up methods must not add entries")
+	assert.Contains(t, methods, "node_getBlockNumber")
+
+	// Methods not labelled by name share the "other" entry
+	lb.RecordMethodLatency("evil_unlearned", time.Millisecond)
+	lb.RecordMethodLatency("evil_unlearned2", time.Millisecond)
+	methods = lb.Snapshot().Methods
+	assert.Len(t, methods, 2)
+	assert.Equal(t, int64(2), methods[metrics.OtherMethod].TotalRequests)
+}
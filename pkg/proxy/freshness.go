@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Freshness headers let clients bound how stale the serving backend may be.
+const (
+	HeaderMinBlock     = "X-Sentinel-Min-Block"     // Only use backends at or above this block
+	HeaderMaxLag       = "X-Sentinel-Max-Lag"       // Only use backends at most this many blocks behind the pool head
+	HeaderBackendBlock = "X-Sentinel-Backend-Block" // Block of the backend that served the response
+	HeaderNodeVersion  = "X-Sentinel-Node-Version"  // Only use backends running this node version
+)
+
+// consistency holds the per-request routing constraints derived from the client.
+type consistency struct {
+	minBlock    int
+	nodeVersion string // Required node version, empty for the pool's version policy
+	session     string // Monotonic-read session key, empty without a session
+}
+
+// constrained reports whether the client narrowed the set of usable backends.
+func (c *consistency) constrained() bool {
+	return c.minBlock > 0 || c.nodeVersion != ""
+}
+
+// flightKey distinguishes coalesced calls by their constraints, so only
+// callers with the same constraints share a backend response.
+func (c *consistency) flightKey() string {
+	if !c.constrained() {
+		return ""
+	}
+	return "|min:" + strconv.Itoa(c.minBlock) + "|version:" + c.nodeVersion
+}
+
+type consistencyKey struct{}
+
+func withConsistency(ctx context.Context, c *consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// consistencyFrom returns the request's constraints, or an empty set.
+func consistencyFrom(ctx context.Context) *consistency {
+	if c, ok := ctx.Value(consistencyKey{}).(*consistency); ok {
+		return c
+	}
+	return &consistency{}
+}
+
+// parseConsistency reads the freshness headers of a request. The lowest
+// acceptable block is the larger of the explicit minimum and the pool head
+// minus the allowed lag.
+func (f *Forwarder) parseConsistency(r *http.Request) (*consistency, error) {
+	c := &consistency{}
+
+	if v := r.Header.Get(HeaderMinBlock); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s header: %q", HeaderMinBlock, v)
+		}
+		c.minBlock = n
+	}
+
+	if v := r.Header.Get(HeaderMaxLag); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s header: %q", HeaderMaxLag, v)
+		}
+		if floor := f.lb.BestBlock() - n; floor > c.minBlock {
+			c.minBlock = floor
+		}
+	}
+
+	c.nodeVersion = r.Header.Get(HeaderNodeVersion)
+
+	return c, nil
+}
+
+// unavailableMessage explains why no backend could serve a request.
+func unavailableMessage(r *http.Request, rt route) string {
+	c := consistencyFrom(r.Context())
+	switch {
+	case c.nodeVersion != "" && c.minBlock > 0:
+		return fmt.Sprintf("No healthy backend running node version %s at or above block %d", c.nodeVersion, c.minBlock)
+	case c.nodeVersion != "":
+		return fmt.Sprintf("No healthy backend running node version %s", c.nodeVersion)
+	case c.minBlock > 0:
+		return fmt.Sprintf("No healthy backend at or above block %d", c.minBlock)
+	}
+	return rt.unavailable
+}
+
+// setBackendBlock reports the block of the serving backend to the client.
+func setBackendBlock(w http.ResponseWriter, block int) {
+	if block > 0 {
+		w.Header().Set(HeaderBackendBlock, strconv.Itoa(block))
+	}
+}
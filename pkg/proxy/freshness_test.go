@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// freshnessPool starts one live backend per block number, each at that block.
+func freshnessPool(t *testing.T, blocks ...int) (*Forwarder, *LoadBalancer, []*int32) {
+	t.Helper()
+	f, lb, hits := livePool(t, len(blocks))
+	for i, block := range blocks {
+		lb.UpdateBackendStateByUrl(lb.backends[i].URL, func(b *Backend) { b.BlockNumber = block })
+	}
+	return f, lb, hits
+}
+
+func freshRequest(headers map[string]string) *http.Request {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[],"id":7}`))
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestForwarder_MinBlockHeader(t *testing.T) {
+	f, _, hits := freshnessPool(t, 100, 120)
+
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		f.Forward(w, freshRequest(map[string]string{HeaderMinBlock: "110"}))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "120", w.Header().Get(HeaderBackendBlock))
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(hits[0]), "backend below the minimum block must not be used")
+	assert.Equal(t, int32(10), atomic.LoadInt32(hits[1]))
+}
+
+func TestForwarder_MaxLagHeader(t *testing.T) {
+	f, _, hits := freshnessPool(t, 100, 120)
+
+	w := httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{HeaderMaxLag: "5"}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(0), atomic.LoadInt32(hits[0]))
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits[1]))
+}
+
+func TestForwarder_NoBackendMeetsMinBlock(t *testing.T) {
+	f, _, _ := freshnessPool(t, 100, 120)
+
+	w := httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{HeaderMinBlock: "500"}))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var resp RPCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, RPCCodeNoBackend, resp.Error.Code)
+	assert.Contains(t, resp.Error.Message, "500")
+	assert.JSONEq(t, "7", string(resp.ID))
+}
+
+func TestForwarder_InvalidFreshnessHeader(t *testing.T) {
+	f, _, _ := freshnessPool(t, 100)
+
+	w := httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{HeaderMaxLag: "soon"}))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp RPCResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, RPCCodeInvalidRequest, resp.Error.Code)
+}
+
+func TestForwarder_CacheHonoursMinBlock(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, `"result":"ok"`)
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withCache)
+	cfg.CacheShortTTL = time.Minute
+	lb := NewLoadBalancer(cfg)
+	lb.UpdateBackendStateByUrl(backend.URL, func(b *Backend) { b.BlockNumber = 100 })
+	f := NewRequestForwarder(cfg, lb)
+
+	f.Forward(httptest.NewRecorder(), freshRequest(nil))
+	w := httptest.NewRecorder()
+	f.Forward(w, freshRequest(nil))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	assert.Equal(t, "100", w.Header().Get(HeaderBackendBlock), "cache hits report the block they were served at")
+
+	lb.UpdateBackendStateByUrl(backend.URL, func(b *Backend) { b.BlockNumber = 101 })
+	f.Forward(httptest.NewRecorder(), freshRequest(map[string]string{HeaderMinBlock: "101"}))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits), "entries older than the minimum block are a miss")
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// BestBlock returns the highest block reported by any healthy backend.
+func (lb *LoadBalancer) BestBlock() int {
+	return lb.current().bestBlock
+}
+
+// recomputeHead recalculates the pool's best block and every backend's lag.
+// Backends lagging more than MaxBlockLag blocks are quarantined until they
+// catch up. Caller holds lb.mu.
+func (lb *LoadBalancer) recomputeHead() {
+	best := 0
+	for _, b := range lb.backends {
+		if b.Healthy && b.BlockNumber > best {
+			best = b.BlockNumber
+		}
+	}
+	lb.bestBlock = best
+
+	for _, b := range lb.backends {
+		b.Lag = 0
+		if best > b.BlockNumber {
+			b.Lag = best - b.BlockNumber
+		}
+
+		lagging := lb.cfg.MaxBlockLag > 0 && b.Healthy && b.Lag > lb.cfg.MaxBlockLag
+		if lagging != b.Lagging {
+			if lagging {
+				log.Warn().Str("url", b.URL).Int("lag", b.Lag).Int("best", best).Msg("Backend quarantined: lagging behind pool head")
+			} else {
+				log.Info().Str("url", b.URL).Int("lag", b.Lag).Msg("Backend caught up with pool head")
+			}
+		}
+		b.Lagging = lagging
+		metrics.SetBackendLag(b.URL, b.Lag)
+	}
+}
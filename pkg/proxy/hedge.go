@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// hedgeMinSamples is the number of latency samples a method needs before its
+// observed percentile replaces the configured fallback delay.
+const hedgeMinSamples = 20
+
+// hedgePolicy decides when a slow call is duplicated onto a second backend.
+type hedgePolicy struct {
+	enabled    bool
+	delay      time.Duration
+	percentile float64
+	methods    map[string]bool // Read-only methods that may be hedged
+}
+
+func newHedgePolicy(cfg *config.Config) *hedgePolicy {
+	methods := make(map[string]bool)
+	for _, m := range cfg.HedgeMethods {
+		methods[m] = true
+	}
+	return &hedgePolicy{
+		enabled:    cfg.HedgeEnabled,
+		delay:      cfg.HedgeDelay,
+		percentile: float64(cfg.HedgePercentile) / 100,
+		methods:    methods,
+	}
+}
+
+// hedgeable reports whether calls to method may be duplicated onto a second
+// backend. Only listed read-only methods qualify, so opaque bodies and
+// unknown calls, which may be writes, are never sent twice.
+func (f *Forwarder) hedgeable(method string) bool {
+	return f.hedge.enabled && f.hedge.methods[method] && f.retry.replaySafe(method)
+}
+
+// hedgeDelayFor returns how long to wait for the first backend before hedging a
+// call: the observed latency percentile of the method, or the fallback delay
+// while too few samples exist.
+func (f *Forwarder) hedgeDelayFor(method string) time.Duration {
+	if p, samples := f.lb.MethodLatencyPercentile(method, f.hedge.percentile); samples >= hedgeMinSamples && p > 0 {
+		return p
+	}
+	return f.hedge.delay
+}
+
+type hedgeResult struct {
+	resp    *upstreamResponse
+	backend *Backend
+	err     error
+	hedged  bool
+}
+
+// send performs one attempt on backend b. Hedgeable calls are hedged when
+// enabled: if b has not answered within the method's hedge delay, the same
+// call is sent to a second backend and the first good response wins.
+func (f *Forwarder) send(r *http.Request, c Criteria, b *Backend, body []byte) (*upstreamResponse, *Backend, error) {
+	if !f.hedgeable(c.Method) {
+		resp, err := f.roundTrip(r, b, body)
+		return resp, b, err
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel() // Cancels the losing attempt
+
+	results := make(chan hedgeResult, 2)
+	launch := func(target *Backend, hedged bool) {
+		go func() {
+			resp, err := f.roundTrip(r.WithContext(ctx), target, body)
+			results <- hedgeResult{resp: resp, backend: target, err: err, hedged: hedged}
+		}()
+	}
+
+	launch(b, false)
+	inflight := 1
+	hedged := false
+
+	timer := time.NewTimer(f.hedgeDelayFor(c.Method))
+	defer timer.Stop()
+	timerC := timer.C
+
+	for {
+		select {
+		case <-timerC:
+			timerC = nil
+			hc := c
+			hc.Exclude = excludeURL(c.Exclude, b.URL)
+			second := f.lb.Select(hc)
+			if second == nil {
+				continue
+			}
+			metrics.RecordHedge(c.Method)
+			log.Debug().Str("method", c.Method).Str("primary", b.URL).Str("hedge", second.URL).Msg("Hedging slow request")
+			launch(second, true)
+			inflight++
+			hedged = true
+
+		case res := <-results:
+			inflight--
+			if inflight > 0 && (retryable(r.Context(), res.resp, res.err) || backendError(r.Context(), res.resp, res.err)) {
+				continue // Give the other attempt a chance
+			}
+			if hedged {
+				winner := "primary"
+				if res.hedged {
+					winner = "hedge"
+				}
+				metrics.RecordHedgeWin(c.Method, winner)
+			}
+			return res.resp, res.backend, res.err
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarder_HedgesSlowBackend(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body) // Lets the server notice the cancelled connection
+		select {
+		case <-time.After(2 * time.Second):
+			w.Write([]byte(`{"jsonrpc":"2.0","result":"slow","id":1}`))
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"fast","id":1}`))
+	}))
+	defer fast.Close()
+
+	cfg := &config.Config{
+		SentinelBackends: []string{slow.URL, fast.URL},
+		HedgeEnabled:     true,
+		HedgeDelay:       20 * time.Millisecond,
+		HedgePercentile:  95,
+		HedgeMethods:     []string{"node_getBlock"},
+	}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlock","params":[1],"id":1}`)))
+
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Contains(t, w.Body.String(), "fast")
+		assert.Less(t, time.Since(start), time.Second, "hedge should answer before the slow backend")
+	}
+}
+
+func TestForwarder_HedgeDelayFromObservedLatency(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://node1"}, HedgeDelay: time.Second, HedgePercentile: 95}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	// Too few samples: fallback delay
+	f.lb.RecordMethodLatency("node_getBlock", 10*time.Millisecond)
+	assert.Equal(t, time.Second, f.hedgeDelayFor("node_getBlock"))
+
+	for i := 1; i <= 100; i++ {
+		f.lb.RecordMethodLatency("node_getBlock", time.Duration(i)*time.Millisecond)
+	}
+	assert.InEpsilon(t, float64(95*time.Millisecond), float64(f.hedgeDelayFor("node_getBlock")), 0.02)
+}
+
+func TestForwarder_HedgesOnlyListedMethods(t *testing.T) {
+	var hits int32
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"ok","id":1}`))
+	}
+	node1 := httptest.NewServer(http.HandlerFunc(slow))
+	defer node1.Close()
+	node2 := httptest.NewServer(http.HandlerFunc(slow))
+	defer node2.Close()
+
+	cfg := &config.Config{
+		SentinelBackends: []string{node1.URL, node2.URL},
+		HedgeEnabled:     true,
+		HedgeDelay:       time.Millisecond,
+		HedgePercentile:  95,
+		HedgeMethods:     []string{"node_getBlock"},
+	}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","method":"node_sendTx","params":[],"id":1}`,
+		`not json-rpc`,
+	} {
+		atomic.StoreInt32(&hits, 0)
+		w := httptest.NewRecorder()
+		f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "%s must reach a single backend", body)
+	}
+}
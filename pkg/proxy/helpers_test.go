@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+)
+
+// blockNumberCall is a replay-safe read for tests indifferent to the method.
+const blockNumberCall = `{"jsonrpc":"2.0","method":"node_getBlockNumber","id":1}`
+
+// methodNotFound is the error member of a "method not found" response.
+const methodNotFound = `"error":{"code":-32601,"message":"Method not found"}`
+
+// testConfig returns a config for the given backends with the options applied.
+func testConfig(backends []string, options ...func(*config.Config)) *config.Config {
+	cfg := &config.Config{SentinelBackends: backends}
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// nodeURLs returns n placeholder backend URLs, http://node1 to http://nodeN.
+func nodeURLs(n int) []string {
+	urls := make([]string, n)
+	for i := range urls {
+		urls[i] = "http://node" + strconv.Itoa(i+1)
+	}
+	return urls
+}
+
+// testPool builds a load balancer over n placeholder backends.
+func testPool(n int, options ...func(*config.Config)) *LoadBalancer {
+	return NewLoadBalancer(testConfig(nodeURLs(n), options...))
+}
+
+// withRetries retries failed calls up to three times with short backoffs and
+// no retry budget, never replaying node_sendTx.
+func withRetries(cfg *config.Config) {
+	cfg.RetryMaxAttempts = 3
+	cfg.RetryBudgetPercent = -1 // Unbounded; the budget is covered by TestRetryBudget
+	cfg.RetryBackoff = time.Millisecond
+	cfg.RetryBackoffMax = 5 * time.Millisecond
+	cfg.RetryExcludedMethods = []string{"node_sendTx"}
+}
+
+// withBreaker opens circuits after three consecutive failures or half of the
+// last ten requests failing, for a minute, then lets two trials through.
+func withBreaker(cfg *config.Config) {
+	cfg.BreakerConsecutiveFailures = 3
+	cfg.BreakerErrorRatePercent = 50
+	cfg.BreakerWindow = 10
+	cfg.BreakerOpenTime = time.Minute
+	cfg.BreakerHalfOpenRequests = 2
+}
+
+// withRPCErrorCodes treats -32603 as a backend failure and -32005 as a
+// retryable one.
+func withRPCErrorCodes(cfg *config.Config) {
+	cfg.RPCBackendErrorCodes = []int{-32603}
+	cfg.RPCRetryableErrorCodes = []int{-32005}
+}
+
+// withOutlierDetection ejects backends three times slower than the pool
+// median or failing a fifth of their requests, once three backends have
+// served ten requests each.
+func withOutlierDetection(cfg *config.Config) {
+	cfg.OutlierLatencyFactor = 3
+	cfg.OutlierErrorRatePercent = 20
+	cfg.OutlierMinRequests = 10
+	cfg.OutlierMinHosts = 3
+	cfg.OutlierBaseEjection = time.Minute
+	cfg.OutlierMaxEjection = 3 * time.Minute
+	cfg.OutlierMaxEjectedPercent = 50
+}
+
+// withSlowStart ramps new and recovered backends up from a tenth of their
+// weight over ten seconds along curve.
+func withSlowStart(curve string) func(*config.Config) {
+	return func(cfg *config.Config) {
+		cfg.SlowStartWindow = 10 * time.Second
+		cfg.SlowStartCurve = curve
+		cfg.SlowStartMinWeightPercent = 10
+	}
+}
+
+// withCache enables a 1 MiB response cache.
+func withCache(cfg *config.Config) {
+	cfg.CacheEnabled = true
+	cfg.CacheMaxBytes = 1 << 20
+}
+
+// livePool starts n backends answering every call with the result "ok" and
+// returns a forwarder over them, its load balancer and the calls each backend
+// received.
+func livePool(t *testing.T, n int, options ...func(*config.Config)) (*Forwarder, *LoadBalancer, []*int32) {
+	t.Helper()
+	hits := make([]*int32, n)
+	var urls []string
+	for i := range hits {
+		hits[i] = new(int32)
+		backend := cannedBackend(hits[i], `"result":"ok"`)
+		t.Cleanup(backend.Close)
+		urls = append(urls, backend.URL)
+	}
+	cfg := testConfig(urls, options...)
+	lb := NewLoadBalancer(cfg)
+	return NewRequestForwarder(cfg, lb), lb, hits
+}
+
+// cannedBackend answers every call with the given member of a JSON-RPC
+// response, e.g. `"result":7`, echoing the call's id. hits counts the calls
+// and may be nil.
+func cannedBackend(hits *int32, member string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits != nil {
+			atomic.AddInt32(hits, 1)
+		}
+		body, _ := io.ReadAll(r.Body)
+		id := "null"
+		if call, err := ParseRPCRequest(body); err == nil && len(call.ID) > 0 {
+			id = string(call.ID)
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0",` + member + `,"id":` + id + `}`))
+	}))
+}
+
+// echoBackend answers every call with its own name as the result.
+func echoBackend(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		call, err := ParseRPCRequest(body)
+		if err != nil {
+			http.Error(w, "expected a single call", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"result":  name + ":" + call.Method,
+			"id":      call.ID,
+		})
+	}))
+}
+
+// statusBackend answers every call with the given HTTP status and no body.
+func statusBackend(hits *int32, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.WriteHeader(status)
+	}))
+}
+
+// rpcRequest returns a client request posting body.
+func rpcRequest(body string) *http.Request {
+	return httptest.NewRequest("POST", "/", strings.NewReader(body))
+}
+
+// forwardCall sends body to f's default route.
+func forwardCall(f *Forwarder, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	f.Forward(w, rpcRequest(body))
+	return w
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Span is an inclusive range of blocks or slots a call needs. A To of 0 leaves
+// the range open-ended.
+type Span struct {
+	From int
+	To   int
+}
+
+// blockSpan returns the L2 blocks a call reads, if its params name them.
+func blockSpan(call *RPCRequest) (*Span, bool) {
+	switch call.Method {
+	case "node_getBlock", "node_getBlockHeader":
+		n, ok := paramInt(call.Params, 0)
+		if !ok {
+			return nil, false // Tags like "latest" are served by any backend
+		}
+		return &Span{From: n, To: n}, true
+	case "node_getBlocks":
+		from, ok := paramInt(call.Params, 0)
+		limit, ok2 := paramInt(call.Params, 1)
+		if !ok || !ok2 || limit < 1 {
+			return nil, false
+		}
+		return &Span{From: from, To: from + limit - 1}, true
+	case "node_getPublicLogs", "node_getContractClassLogs":
+		p := positionalParams(call.Params)
+		if len(p) == 0 {
+			return nil, false
+		}
+		var filter struct {
+			FromBlock json.RawMessage `json:"fromBlock"`
+			ToBlock   json.RawMessage `json:"toBlock"`
+		}
+		if json.Unmarshal(p[0], &filter) != nil {
+			return nil, false
+		}
+		s := &Span{}
+		if from, ok := rawInt(filter.FromBlock); ok {
+			s.From = from
+		}
+		if to, ok := rawInt(filter.ToBlock); ok && to > s.From {
+			s.To = to - 1 // toBlock is exclusive
+		}
+		return s, true
+	}
+	return nil, false
+}
+
+// slotSpan returns the slots a call reads, if its params name them.
+func slotSpan(call *RPCRequest) (*Span, bool) {
+	if call.Method != "node_getValidatorStats" {
+		return nil, false
+	}
+	from, ok := paramInt(call.Params, 1)
+	if !ok {
+		return nil, false
+	}
+	s := &Span{From: from}
+	if to, ok := paramInt(call.Params, 2); ok {
+		s.To = to
+	}
+	return s, true
+}
+
+// covers reports whether b retains the blocks and slots c asks for.
+// Caller holds lb.mu.
+func covers(b *Backend, c Criteria) bool {
+	if s := c.Blocks; s != nil {
+		if b.OldestBlock > s.From {
+			return false
+		}
+		if s.To > 0 && b.BlockNumber < s.To {
+			return false
+		}
+	}
+	if s := c.Slots; s != nil && b.EpochStats != nil && b.EpochStats.OldestSlot > s.From {
+		return false
+	}
+	return true
+}
+
+// RangeUnavailable reports whether backends could serve c if it did not ask
+// for a block or slot range, but none of them retains that range. Backends
+// already tried for the request are not ruled out.
+func (lb *LoadBalancer) RangeUnavailable(c Criteria) bool {
+	if c.Blocks == nil && c.Slots == nil {
+		return false
+	}
+	c.Exclude = nil
+	loose := c
+	loose.Blocks, loose.Slots = nil, nil
+	return !lb.available(c) && lb.available(loose)
+}
+
+// SetOldestBlock records the oldest block the backend with the given URL
+// retains, as measured by the retention probe, replacing any block learned
+// from live traffic. 0 means the backend retains the full history.
+func (lb *LoadBalancer) SetOldestBlock(url string, n int) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	b := lb.lookup(url)
+	if b == nil || b.OldestBlock == n {
+		return
+	}
+	log.Info().Str("url", url).Int("from", b.OldestBlock).Int("to", n).Msg("Backend retention floor changed")
+	b.OldestBlock = n
+	lb.publish()
+}
+
+// MarkBlockPruned records that the backend with the URL of b no longer
+// serves block n, raising the oldest block it is assumed to retain until the
+// next retention probe measures it.
+func (lb *LoadBalancer) MarkBlockPruned(b *Backend, n int) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	b = lb.lookup(b.URL)
+	if b == nil || n >= b.BlockNumber {
+		return // Not produced yet on this backend
+	}
+	if n < b.OldestBlock {
+		return // Already known
+	}
+	b.OldestBlock = n + 1
+	lb.publish()
+	log.Info().Str("url", b.URL).Int("oldestBlock", b.OldestBlock).Msg("Backend has pruned historical blocks")
+}
+
+// markPruned checks a backend response for a null block that is behind the
+// backend's head and records the backend as pruned below it. It reports
+// whether the call should go to another backend.
+func (f *Forwarder) markPruned(r *http.Request, b *Backend, resp *upstreamResponse) bool {
+	call := RPCRequestFromContext(r.Context())
+	if call == nil || b == nil || resp.status != http.StatusOK || resp.rpcErr != nil {
+		return false
+	}
+	if call.Method != "node_getBlock" && call.Method != "node_getBlockHeader" {
+		return false
+	}
+	n, ok := paramInt(call.Params, 0)
+	if !ok || n >= resp.block {
+		return false
+	}
+	var rpcResp RPCResponse
+	if json.Unmarshal(resp.body, &rpcResp) != nil || rpcResp.Error != nil {
+		return false
+	}
+	if len(rpcResp.Result) != 0 && string(rpcResp.Result) != "null" {
+		return false
+	}
+	f.lb.MarkBlockPruned(b, n)
+	resp.pruned = true
+	return true
+}
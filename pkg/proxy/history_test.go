@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockSpan(t *testing.T) {
+	cases := []struct {
+		body string
+		want *Span
+	}{
+		{`{"jsonrpc":"2.0","method":"node_getBlock","params":[42],"id":1}`, &Span{From: 42, To: 42}},
+		{`{"jsonrpc":"2.0","method":"node_getBlock","params":["latest"],"id":1}`, nil},
+		{`{"jsonrpc":"2.0","method":"node_getBlocks","params":[10,5],"id":1}`, &Span{From: 10, To: 14}},
+		{`{"jsonrpc":"2.0","method":"node_getPublicLogs","params":[{"fromBlock":10,"toBlock":20}],"id":1}`, &Span{From: 10, To: 19}},
+		{`{"jsonrpc":"2.0","method":"node_getPublicLogs","params":[{"contractAddress":"0x01"}],"id":1}`, &Span{}},
+		{`{"jsonrpc":"2.0","method":"node_getBlockNumber","params":[],"id":1}`, nil},
+	}
+	for _, tc := range cases {
+		call, err := ParseRPCRequest([]byte(tc.body))
+		assert.NoError(t, err)
+		got, _ := blockSpan(call)
+		assert.Equal(t, tc.want, got, tc.body)
+	}
+}
+
+func TestSelect_RoutesByRetainedRange(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://pruned", "http://full"}}
+	lb := NewLoadBalancer(cfg)
+	lb.UpdateBackendStateByUrl("http://pruned", func(b *Backend) {
+		b.BlockNumber = 1000
+		b.OldestBlock = 900
+		b.EpochStats = &EpochStats{OldestSlot: 5000}
+	})
+	lb.UpdateBackendStateByUrl("http://full", func(b *Backend) {
+		b.BlockNumber = 990
+		b.EpochStats = &EpochStats{OldestSlot: 10}
+	})
+
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "http://full", lb.Select(Criteria{Blocks: &Span{From: 100, To: 100}}).URL)
+		assert.Equal(t, "http://pruned", lb.Select(Criteria{Blocks: &Span{From: 995, To: 995}}).URL)
+		assert.Equal(t, "http://full", lb.Select(Criteria{Slots: &Span{From: 100}}).URL)
+	}
+
+	// Nobody has reached the end of the range yet: retaining its start is enough
+	assert.NotNil(t, lb.Select(Criteria{Blocks: &Span{From: 995, To: 1005}}))
+
+	// Nobody retains the range: fail instead of asking a backend that pruned it
+	lb.UpdateBackendStateByUrl("http://full", func(b *Backend) { b.Healthy = false })
+	old := Criteria{Blocks: &Span{From: 100, To: 100}}
+	assert.Nil(t, lb.Select(old))
+	assert.True(t, lb.RangeUnavailable(old))
+	assert.False(t, lb.RangeUnavailable(Criteria{Blocks: &Span{From: 995, To: 995}}))
+}
+
+func TestForwarder_LearnsPrunedBlocks(t *testing.T) {
+	var prunedHits, fullHits int32
+	pruned := cannedBackend(&prunedHits, `"result":null`)
+	defer pruned.Close()
+	full := cannedBackend(&fullHits, `"result":{"number":5}`)
+	defer full.Close()
+
+	cfg := &config.Config{
+		SentinelBackends:   []string{pruned.URL, full.URL},
+		RetryMaxAttempts:   2,
+		RetryBudgetPercent: 100,
+	}
+	lb := NewLoadBalancer(cfg)
+	for _, url := range cfg.SentinelBackends {
+		lb.UpdateBackendStateByUrl(url, func(b *Backend) { b.BlockNumber = 100 })
+	}
+	f := NewRequestForwarder(cfg, lb)
+
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlock","params":[5],"id":1}`)))
+		assert.Contains(t, w.Body.String(), `"number":5`, "a pruned null is retried on a backend retaining the block")
+	}
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&prunedHits), int32(1), "a backend answering null for an old block is not asked again")
+	assert.Equal(t, 6, lb.backends[0].OldestBlock)
+}
+
+func TestForwarder_DoesNotCachePrunedNull(t *testing.T) {
+	var hits int32
+	pruned := cannedBackend(&hits, `"result":null`)
+	defer pruned.Close()
+
+	cfg := testConfig([]string{pruned.URL}, withCache)
+	cfg.CacheShortTTL = time.Minute
+	lb := NewLoadBalancer(cfg)
+	lb.UpdateBackendStateByUrl(pruned.URL, func(b *Backend) { b.BlockNumber = 100 })
+	f := NewRequestForwarder(cfg, lb)
+
+	forwardCall(f, `{"jsonrpc":"2.0","method":"node_getBlock","params":[5],"id":1}`)
+	assert.Zero(t, f.cache.Len(), "nobody else retains the block, but its null must not be cached")
+}
+
+func TestForwarder_RangeUnavailable(t *testing.T) {
+	var hits int32
+	pruned := cannedBackend(&hits, `"result":null`)
+	defer pruned.Close()
+
+	cfg := &config.Config{SentinelBackends: []string{pruned.URL}}
+	lb := NewLoadBalancer(cfg)
+	lb.UpdateBackendStateByUrl(pruned.URL, func(b *Backend) { b.BlockNumber = 100 })
+	f := NewRequestForwarder(cfg, lb)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		f.Forward(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"node_getBlock","params":[5],"id":1}`)))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), strconv.Itoa(RPCCodeRangeUnavailable))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "only the first call learns the backend pruned the block")
+}
+
+func TestSetOldestBlock_ReplacesLearnedBlock(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://node1"}}
+	lb := NewLoadBalancer(cfg)
+	lb.UpdateBackendStateByUrl("http://node1", func(b *Backend) { b.BlockNumber = 100 })
+	b := lb.backends[0]
+	old := Criteria{Blocks: &Span{From: 5, To: 5}}
+
+	lb.MarkBlockPruned(b, 9)
+	assert.Equal(t, 10, b.OldestBlock)
+	assert.False(t, covers(b, old))
+	lb.MarkBlockPruned(b, 4)
+	assert.Equal(t, 10, b.OldestBlock, "a lower block does not lower a learned floor")
+
+	// The retention probe measures the backend and replaces the learned floor
+	lb.SetOldestBlock("http://node1", 3)
+	assert.Equal(t, 3, lb.Snapshot().Backends[0].OldestBlock)
+	assert.True(t, covers(b, old))
+}
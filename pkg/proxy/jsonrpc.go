@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// MaxRequestBodyBytes caps the size of a client request body read by the Forwarder.
+const MaxRequestBodyBytes = 10 << 20
+
+// JSON-RPC error codes produced by the proxy itself.
+const (
+	RPCCodeInvalidRequest   = -32600
+	RPCCodeInternalError    = -32603
+	RPCCodeNoBackend        = -32001 // No backend could serve the call
+	RPCCodeUpstreamError    = -32002 // The backend failed or returned an unreadable response
+	RPCCodeRangeUnavailable = -32004 // No backend retains the requested blocks or slots
+)
+
+var errNotJSONRPC = errors.New("body is not a JSON-RPC request")
+
+var nullID = json.RawMessage("null")
+
+// RPCRequest is the decoded envelope of a single JSON-RPC call.
+// Params and ID are kept raw so they can be forwarded untouched.
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+
+	raw json.RawMessage // The call as the client sent it
+}
+
+// RPCError is a JSON-RPC error object.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// RPCResponse is the envelope of a single JSON-RPC response.
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcRequestKey struct{}
+
+type rpcBatchKey struct{}
+
+// ParseRPCRequest decodes a single JSON-RPC call from a request body.
+func ParseRPCRequest(body []byte) (*RPCRequest, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, errNotJSONRPC
+	}
+
+	var req RPCRequest
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		return nil, err
+	}
+	if req.Method == "" {
+		return nil, errNotJSONRPC
+	}
+	req.raw = trimmed
+	return &req, nil
+}
+
+// ParseRPCBatch decodes a JSON-RPC batch array. Elements that are not valid
+// calls are returned as nil so the caller can answer them with an error. An
+// empty array decodes to an empty batch, itself an invalid request.
+func ParseRPCBatch(body []byte) ([]*RPCRequest, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, errNotJSONRPC
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(trimmed, &raw); err != nil {
+		return nil, err
+	}
+	batch := make([]*RPCRequest, len(raw))
+	for i, elem := range raw {
+		if req, err := ParseRPCRequest(elem); err == nil {
+			batch[i] = req
+		}
+	}
+	return batch, nil
+}
+
+// IsNotification reports whether the call expects no response.
+func (r *RPCRequest) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+// responseID returns the id to echo back to the caller.
+func (r *RPCRequest) responseID() json.RawMessage {
+	if r == nil || len(r.ID) == 0 {
+		return nullID
+	}
+	return r.ID
+}
+
+// WithRPCRequest returns a copy of ctx carrying the decoded JSON-RPC call.
+func WithRPCRequest(ctx context.Context, req *RPCRequest) context.Context {
+	return context.WithValue(ctx, rpcRequestKey{}, req)
+}
+
+// RPCRequestFromContext returns the JSON-RPC call decoded by the Forwarder, if any.
+func RPCRequestFromContext(ctx context.Context) *RPCRequest {
+	req, _ := ctx.Value(rpcRequestKey{}).(*RPCRequest)
+	return req
+}
+
+// methodOf returns the JSON-RPC method for logging, or "unknown" for opaque bodies.
+func methodOf(ctx context.Context) string {
+	if req := RPCRequestFromContext(ctx); req != nil {
+		return req.Method
+	}
+	return "unknown"
+}
+
+// WithRPCBatch returns a copy of ctx carrying a decoded JSON-RPC batch.
+func WithRPCBatch(ctx context.Context, batch []*RPCRequest) context.Context {
+	return context.WithValue(ctx, rpcBatchKey{}, batch)
+}
+
+// RPCBatchFromContext returns the JSON-RPC batch decoded by the Forwarder, if any.
+func RPCBatchFromContext(ctx context.Context) []*RPCRequest {
+	batch, _ := ctx.Value(rpcBatchKey{}).([]*RPCRequest)
+	return batch
+}
+
+// responseError returns the error object of a single JSON-RPC response, or
+// nil for results, batches and bodies that are not JSON-RPC.
+func responseError(body []byte) *RPCError {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil
+	}
+	var resp struct {
+		Error *RPCError `json:"error"`
+	}
+	if json.Unmarshal(trimmed, &resp) != nil {
+		return nil
+	}
+	return resp.Error
+}
+
+// rpcErrorResponse builds a JSON-RPC error response for the given id.
+func rpcErrorResponse(id json.RawMessage, code int, message string) []byte {
+	if len(id) == 0 {
+		id = nullID
+	}
+	body, _ := json.Marshal(RPCResponse{
+		JSONRPC: "2.0",
+		Error:   &RPCError{Code: code, Message: message},
+		ID:      id,
+	})
+	return body
+}
+
+// withID rewrites the id of a single JSON-RPC response, leaving all other
+// members untouched.
+func withID(body []byte, id json.RawMessage) ([]byte, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, err
+	}
+	if len(id) == 0 {
+		id = nullID
+	}
+	members["id"] = id
+	return json.Marshal(members)
+}
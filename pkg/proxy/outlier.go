@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// outlierQuantile is the latency percentile compared across the pool.
+const outlierQuantile = 0.9
+
+// outlierStats is what the detector remembers about a backend between runs.
+type outlierStats struct {
+	requests int64 // TotalRequests at the previous run
+	errors   int64 // TotalErrors at the previous run
+}
+
+// DetectOutliers compares every healthy backend's p90 latency and error rate
+// since the previous run against the pool median and ejects outliers. Each
+// ejection lasts longer than the previous one for the same backend, and no
+// more than OutlierMaxEjectedPercent of the pool is ejected at once.
+func (lb *LoadBalancer) DetectOutliers() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.detectOutliers(time.Now())
+}
+
+func (lb *LoadBalancer) detectOutliers(now time.Time) {
+	defer lb.publish()
+
+	type sample struct {
+		b         *Backend
+		latency   time.Duration
+		errorRate float64
+	}
+
+	var samples []sample
+	ejected := 0
+	for _, b := range lb.backends {
+		if b.Ejected && !now.Before(b.EjectedUntil) {
+			b.Ejected = false
+			metrics.SetBackendEjected(b.URL, false)
+			log.Info().Str("url", b.URL).Msg("Outlier ejection ended")
+		}
+		if b.Ejected {
+			ejected++
+		}
+
+		rs := b.RequestStats
+		if rs == nil {
+			continue
+		}
+		total, failed := atomic.LoadInt64(&rs.TotalRequests), atomic.LoadInt64(&rs.TotalErrors)
+		requests := total - b.outlier.requests
+		errors := failed - b.outlier.errors
+		b.outlier = outlierStats{requests: total, errors: failed}
+
+		if !b.Healthy || b.Ejected || requests < int64(lb.cfg.OutlierMinRequests) || requests == 0 {
+			continue
+		}
+		samples = append(samples, sample{
+			b:         b,
+			latency:   rs.Percentile(outlierQuantile),
+			errorRate: float64(errors) / float64(requests),
+		})
+	}
+
+	if len(samples) < max(lb.cfg.OutlierMinHosts, 2) {
+		return
+	}
+
+	latencies := make([]float64, len(samples))
+	rates := make([]float64, len(samples))
+	for i, s := range samples {
+		latencies[i] = float64(s.latency)
+		rates[i] = s.errorRate
+	}
+	medianLatency := median(latencies)
+	medianRate := median(rates)
+
+	maxEjected := max(len(lb.backends)*lb.cfg.OutlierMaxEjectedPercent/100, 1)
+	for _, s := range samples {
+		reason := ""
+		switch {
+		case lb.cfg.OutlierLatencyFactor > 0 && float64(s.latency) > medianLatency*float64(lb.cfg.OutlierLatencyFactor):
+			reason = "latency"
+		case lb.cfg.OutlierErrorRatePercent > 0 && (s.errorRate-medianRate)*100 >= float64(lb.cfg.OutlierErrorRatePercent):
+			reason = "errors"
+		}
+
+		if reason == "" {
+			if s.b.Ejections > 0 {
+				s.b.Ejections-- // Good behaviour shortens the next ejection
+			}
+			continue
+		}
+		if ejected >= maxEjected {
+			log.Warn().Str("url", s.b.URL).Str("reason", reason).Int("ejected", ejected).Msg("Outlier not ejected: too much of the pool is ejected already")
+			continue
+		}
+
+		s.b.Ejections++
+		duration := lb.cfg.OutlierBaseEjection * time.Duration(s.b.Ejections)
+		if lb.cfg.OutlierMaxEjection > 0 && duration > lb.cfg.OutlierMaxEjection {
+			duration = lb.cfg.OutlierMaxEjection
+		}
+		s.b.Ejected = true
+		s.b.EjectedUntil = now.Add(duration)
+		ejected++
+
+		metrics.SetBackendEjected(s.b.URL, true)
+		metrics.RecordOutlierEjection(s.b.URL, reason)
+		log.Warn().
+			Str("url", s.b.URL).
+			Str("reason", reason).
+			Dur("p90", s.latency).
+			Dur("medianP90", time.Duration(medianLatency)).
+			Float64("errorRate", s.errorRate).
+			Dur("duration", duration).
+			Msg("Backend ejected as outlier")
+	}
+}
+
+// ejected reports whether b is currently ejected as an outlier. Caller holds lb.mu.
+func (b *Backend) ejected(now time.Time) bool {
+	return b.Ejected && now.Before(b.EjectedUntil)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
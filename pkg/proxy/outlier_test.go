@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serve records n requests of the given latency on b, errors of them failing.
+func serve(lb *LoadBalancer, b *Backend, n, errors int, latency time.Duration) {
+	for i := 0; i < n; i++ {
+		if i < errors {
+			lb.IncErrorRequest(b)
+			continue
+		}
+		lb.IncSuccessfulRequest(b, 200, latency)
+	}
+}
+
+func TestOutliers_EjectsSlowBackend(t *testing.T) {
+	lb := testPool(4, withOutlierDetection)
+	serve(lb, lb.backends[0], 20, 0, 10*time.Millisecond)
+	serve(lb, lb.backends[1], 20, 0, 12*time.Millisecond)
+	serve(lb, lb.backends[2], 20, 0, 11*time.Millisecond)
+	serve(lb, lb.backends[3], 20, 0, 150*time.Millisecond)
+
+	now := time.Now()
+	lb.detectOutliers(now)
+
+	assert.True(t, lb.backends[3].Ejected)
+	assert.Equal(t, now.Add(time.Minute), lb.backends[3].EjectedUntil)
+	for _, b := range lb.backends[:3] {
+		assert.False(t, b.Ejected)
+	}
+	for i := 0; i < 20; i++ {
+		assert.NotEqual(t, "http://node4", lb.Select(Criteria{}).URL)
+	}
+}
+
+func TestOutliers_EjectsErroringBackend(t *testing.T) {
+	lb := testPool(3, withOutlierDetection)
+	serve(lb, lb.backends[0], 20, 0, 10*time.Millisecond)
+	serve(lb, lb.backends[1], 20, 1, 10*time.Millisecond)
+	serve(lb, lb.backends[2], 20, 10, 10*time.Millisecond)
+
+	lb.detectOutliers(time.Now())
+
+	assert.False(t, lb.backends[0].Ejected)
+	assert.False(t, lb.backends[1].Ejected)
+	assert.True(t, lb.backends[2].Ejected)
+}
+
+func TestOutliers_IncreasingEjectionTime(t *testing.T) {
+	lb := testPool(3, withOutlierDetection)
+	slow := lb.backends[2]
+	now := time.Now()
+
+	for round := 1; round <= 4; round++ {
+		serve(lb, lb.backends[0], 20, 0, 10*time.Millisecond)
+		serve(lb, lb.backends[1], 20, 0, 10*time.Millisecond)
+		serve(lb, slow, 100, 0, 200*time.Millisecond) // Fill its latency window
+		lb.detectOutliers(now)
+
+		want := min(time.Duration(round)*time.Minute, 3*time.Minute)
+		assert.Equal(t, now.Add(want), slow.EjectedUntil, "round %d", round)
+		now = slow.EjectedUntil
+	}
+
+	lb.detectOutliers(now)
+	assert.False(t, slow.Ejected, "ejection ends once its time is up")
+}
+
+func TestOutliers_MaxEjectedPercent(t *testing.T) {
+	lb := testPool(4, withOutlierDetection) // 50% of 4: at most 2 ejected
+	serve(lb, lb.backends[0], 20, 0, 10*time.Millisecond)
+	serve(lb, lb.backends[1], 20, 0, 10*time.Millisecond)
+	serve(lb, lb.backends[2], 20, 20, 10*time.Millisecond)
+	serve(lb, lb.backends[3], 20, 20, 10*time.Millisecond)
+	lb.detectOutliers(time.Now())
+
+	serve(lb, lb.backends[0], 20, 0, 10*time.Millisecond)
+	serve(lb, lb.backends[1], 20, 20, 10*time.Millisecond)
+	lb.detectOutliers(time.Now())
+
+	ejected := 0
+	for _, b := range lb.backends {
+		if b.Ejected {
+			ejected++
+		}
+	}
+	assert.Equal(t, 2, ejected)
+}
+
+func TestOutliers_NeedsEnoughHosts(t *testing.T) {
+	lb := testPool(2, withOutlierDetection)
+	serve(lb, lb.backends[0], 20, 0, 10*time.Millisecond)
+	serve(lb, lb.backends[1], 20, 0, 500*time.Millisecond)
+
+	lb.detectOutliers(time.Now())
+	assert.False(t, lb.backends[1].Ejected, "no meaningful median with fewer than OutlierMinHosts backends")
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// positionalParams splits a params array into its raw elements.
+func positionalParams(params json.RawMessage) []json.RawMessage {
+	var out []json.RawMessage
+	if err := json.Unmarshal(params, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// paramInt reads the idx-th positional param as an integer, accepting JSON
+// numbers as well as decimal or 0x-prefixed hex strings.
+func paramInt(params json.RawMessage, idx int) (int, bool) {
+	p := positionalParams(params)
+	if idx >= len(p) {
+		return 0, false
+	}
+	return rawInt(p[idx])
+}
+
+// rawInt decodes a JSON number or numeric string.
+func rawInt(raw json.RawMessage) (int, bool) {
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, true
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, false
+	}
+	if strings.HasPrefix(s, "0x") {
+		v, err := strconv.ParseInt(s[2:], 16, 64)
+		return int(v), err == nil
+	}
+	v, err := strconv.Atoi(s)
+	return v, err == nil
+}
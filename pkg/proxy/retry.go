@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+)
+
+const (
+	// retryBudgetMinTokens lets a quiet proxy retry even before traffic has
+	// deposited into the budget.
+	retryBudgetMinTokens = 10
+	retryBudgetMaxTokens = 100
+)
+
+// retryPolicy decides whether and when a failed request is replayed on another backend.
+type retryPolicy struct {
+	maxAttempts int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+	excluded    map[string]bool
+	budget      *retryBudget
+}
+
+func newRetryPolicy(cfg *config.Config) *retryPolicy {
+	excluded := make(map[string]bool)
+	for _, m := range cfg.RetryExcludedMethods {
+		excluded[m] = true
+	}
+	return &retryPolicy{
+		maxAttempts: cfg.RetryMaxAttempts,
+		backoffBase: cfg.RetryBackoff,
+		backoffMax:  cfg.RetryBackoffMax,
+		excluded:    excluded,
+		budget:      newRetryBudget(float64(cfg.RetryBudgetPercent) / 100),
+	}
+}
+
+// allows reports whether failed calls to method may be retried.
+func (p *retryPolicy) allows(method string) bool {
+	return p.maxAttempts > 1 && p.replaySafe(method)
+}
+
+// replaySafe reports whether method may be sent to a backend more than once.
+func (p *retryPolicy) replaySafe(method string) bool {
+	return !p.excluded[method]
+}
+
+// backoff returns a full-jitter exponential delay before retry n (1-based).
+func (p *retryPolicy) backoff(n int) time.Duration {
+	if p.backoffBase <= 0 {
+		return 0
+	}
+	d := p.backoffBase << (n - 1)
+	if p.backoffMax > 0 && (d > p.backoffMax || d <= 0) {
+		d = p.backoffMax
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// retryBudget is a token bucket shared by all requests: every request deposits
+// ratio tokens and every retry withdraws one, so retries stay a bounded share
+// of traffic when backends fail en masse.
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{ratio: ratio, tokens: retryBudgetMinTokens}
+}
+
+func (rb *retryBudget) deposit() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.tokens += rb.ratio
+	if rb.tokens > retryBudgetMaxTokens {
+		rb.tokens = retryBudgetMaxTokens
+	}
+}
+
+// withdraw takes a token for one retry. A ratio of 0 denies every retry and a
+// negative ratio leaves retries unbounded.
+func (rb *retryBudget) withdraw() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	switch {
+	case rb.ratio < 0:
+		return true
+	case rb.ratio == 0:
+		return false
+	}
+	if rb.tokens < 1 {
+		return false
+	}
+	rb.tokens--
+	return true
+}
+
+// retryable reports whether an attempt failed in a way another backend may fix.
+// Failures caused by the client going away are never retried.
+func retryable(ctx context.Context, resp *upstreamResponse, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.status >= http.StatusInternalServerError || resp.status == http.StatusTooManyRequests || resp.rpcClass == RPCErrorRetryable
+}
+
+// backendError reports whether an attempt was answered with a JSON-RPC error
+// the backend is at fault for but that is not known to be retryable. Such a
+// call is failed over once: if it fails on a second backend too, the call
+// itself is the likely cause and the error is relayed.
+func backendError(ctx context.Context, resp *upstreamResponse, err error) bool {
+	return ctx.Err() == nil && err == nil && resp.rpcClass == RPCErrorBackend
+}
+
+// sleepContext waits for d or until ctx is done, reporting whether the full delay elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
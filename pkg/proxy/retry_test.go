@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarder_RetriesOnAnotherBackend(t *testing.T) {
+	var failedHits int32
+	failing := statusBackend(&failedHits, http.StatusInternalServerError)
+	defer failing.Close()
+	healthy := cannedBackend(nil, `"result":42`)
+	defer healthy.Close()
+
+	cfg := testConfig([]string{failing.URL, healthy.URL}, withRetries)
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	for i := 0; i < 20; i++ {
+		w := forwardCall(f, blockNumberCall)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","result":42,"id":1}`, w.Body.String())
+	}
+	assert.Greater(t, atomic.LoadInt32(&failedHits), int32(0), "failing backend should have been tried")
+}
+
+func TestForwarder_DoesNotRetryExcludedMethods(t *testing.T) {
+	var hits int32
+	b1 := statusBackend(&hits, http.StatusInternalServerError)
+	defer b1.Close()
+	b2 := statusBackend(&hits, http.StatusInternalServerError)
+	defer b2.Close()
+
+	cfg := testConfig([]string{b1.URL, b2.URL}, withRetries)
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	w := forwardCall(f, `{"jsonrpc":"2.0","method":"node_sendTx","id":1}`)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestForwarder_TransportErrorWithoutFallback(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	cfg := testConfig([]string{down.URL}, withRetries)
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+
+	w := forwardCall(f, blockNumberCall)
+
+	assert.Equal(t, http.StatusBadGateway, w.Result().StatusCode)
+	assert.Equal(t, int64(1), lb.Snapshot().Backends[0].RequestStats.TotalErrors)
+}
+
+func TestRetryBudget(t *testing.T) {
+	rb := newRetryBudget(0.5)
+
+	// Reserve tokens are available before any traffic
+	for i := 0; i < retryBudgetMinTokens; i++ {
+		assert.True(t, rb.withdraw())
+	}
+	assert.False(t, rb.withdraw(), "budget should be exhausted")
+
+	// Two requests earn one retry
+	rb.deposit()
+	rb.deposit()
+	assert.True(t, rb.withdraw())
+	assert.False(t, rb.withdraw())
+}
+
+func TestRetryBudget_ZeroDeniesNegativeUnbounded(t *testing.T) {
+	off := newRetryBudget(0)
+	off.deposit()
+	assert.False(t, off.withdraw(), "a zero budget should deny even the reserve tokens")
+
+	unbounded := newRetryBudget(-0.01)
+	for i := 0; i < 2*retryBudgetMaxTokens; i++ {
+		assert.True(t, unbounded.withdraw())
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &retryPolicy{backoffBase: 10 * time.Millisecond, backoffMax: 25 * time.Millisecond}
+	for n := 1; n <= 5; n++ {
+		d := p.backoff(n)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, 25*time.Millisecond)
+	}
+}
+
+func TestForwarder_MethodNotFoundGoesElsewhere(t *testing.T) {
+	var missingHits, okHits int32
+	missing := cannedBackend(&missingHits, methodNotFound)
+	defer missing.Close()
+	ok := cannedBackend(&okHits, `"result":[]`)
+	defer ok.Close()
+
+	cfg := testConfig([]string{missing.URL, ok.URL}, withRetries)
+	cfg.CapabilityProbeMethods = []string{"node_getPublicLogs"}
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	for i := 0; i < 20; i++ {
+		w := forwardCall(f, `{"jsonrpc":"2.0","method":"node_getPublicLogs","params":[{}],"id":1}`)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","result":[],"id":1}`, w.Body.String())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&missingHits), "the method is not routed to the backend again")
+	assert.Equal(t, int32(20), atomic.LoadInt32(&okHits))
+}
+
+func TestForwarder_RelaysMethodNotFound(t *testing.T) {
+	var hits int32
+	node1 := cannedBackend(&hits, methodNotFound)
+	defer node1.Close()
+	node2 := cannedBackend(&hits, methodNotFound)
+	defer node2.Close()
+
+	cfg := testConfig([]string{node1.URL, node2.URL}, withRetries)
+	cfg.CapabilityProbeMethods = []string{"node_getL2Tips"}
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+
+	// A probed method nobody serves is marked on every backend and its error relayed
+	w := forwardCall(f, `{"jsonrpc":"2.0","method":"node_getL2Tips","id":1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "-32601")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	// From then on the proxy answers "method not found" without a backend request
+	for i := 0; i < 3; i++ {
+		w := forwardCall(f, `{"jsonrpc":"2.0","method":"node_getL2Tips","id":7}`)
+		assert.Equal(t, http.StatusOK, w.Code, "call %d", i+2)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"`+methodNotSupportedMessage+`"},"id":7}`, w.Body.String(), "call %d", i+2)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits), "no backend is asked for a method every backend lacks")
+
+	// Made-up names are relayed from one backend and never remembered
+	atomic.StoreInt32(&hits, 0)
+	for i := 0; i < 50; i++ {
+		w := forwardCall(f, `{"jsonrpc":"2.0","method":"made_up`+strconv.Itoa(i)+`","id":1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "-32601")
+	}
+	assert.Equal(t, int32(50), atomic.LoadInt32(&hits))
+	for _, b := range lb.Snapshot().Backends {
+		assert.LessOrEqual(t, len(b.UnsupportedMethods), 1)
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"github.com/DashNode-Org/sentinel-proxy/config"
+)
+
+// Classes of JSON-RPC error responses.
+const (
+	RPCErrorClient    = "client"    // The error is the answer to the call, whichever backend serves it
+	RPCErrorBackend   = "backend"   // The backend failed to serve the call
+	RPCErrorRetryable = "retryable" // The backend cannot serve the call right now, another one may
+)
+
+// rpcErrorPolicy classifies the JSON-RPC errors backends answer with. Backend
+// and retryable errors count as failures in the request stats and for the
+// circuit breaker, and both are failed over to another backend for replay-safe
+// methods. Retryable errors are retried while attempts remain; backend errors
+// only once, since a call that makes a node fail, such as one hitting a
+// handler bug, would make every node fail.
+type rpcErrorPolicy struct {
+	classes map[int]string
+}
+
+func newRPCErrorPolicy(cfg *config.Config) *rpcErrorPolicy {
+	classes := make(map[int]string)
+	for _, code := range cfg.RPCBackendErrorCodes {
+		classes[code] = RPCErrorBackend
+	}
+	for _, code := range cfg.RPCRetryableErrorCodes {
+		classes[code] = RPCErrorRetryable
+	}
+	return &rpcErrorPolicy{classes: classes}
+}
+
+// classify returns the class of a JSON-RPC error, or "" for none. Codes not
+// configured otherwise are client errors: invalid params, unknown methods and
+// application errors are answered the same by every backend.
+func (p *rpcErrorPolicy) classify(e *RPCError) string {
+	if e == nil {
+		return ""
+	}
+	if class, ok := p.classes[e.Code]; ok {
+		return class
+	}
+	return RPCErrorClient
+}
+
+// backendFault reports whether an error of the given class is held against
+// the backend that returned it.
+func backendFault(class string) bool {
+	return class == RPCErrorBackend || class == RPCErrorRetryable
+}
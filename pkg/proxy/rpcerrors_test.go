@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rpcError is the error member of a response carrying the given code.
+func rpcError(code string) string {
+	return `"error":{"code":` + code + `,"message":"failed"}`
+}
+
+func TestRPCErrorPolicy_Classify(t *testing.T) {
+	p := newRPCErrorPolicy(testConfig(nil, withRPCErrorCodes))
+
+	assert.Equal(t, "", p.classify(nil))
+	assert.Equal(t, RPCErrorBackend, p.classify(&RPCError{Code: -32603}))
+	assert.Equal(t, RPCErrorRetryable, p.classify(&RPCError{Code: -32005}))
+	assert.Equal(t, RPCErrorClient, p.classify(&RPCError{Code: -32602}))
+	assert.Equal(t, RPCErrorClient, p.classify(&RPCError{Code: rpcCodeMethodNotFound}))
+	assert.Equal(t, RPCErrorClient, p.classify(&RPCError{Code: 3}), "application errors are answers")
+}
+
+func TestForwarder_BackendRPCErrorsTripTheBreaker(t *testing.T) {
+	var badHits, okHits int32
+	bad := cannedBackend(&badHits, rpcError("-32603"))
+	defer bad.Close()
+	ok := cannedBackend(&okHits, `"result":7`)
+	defer ok.Close()
+
+	cfg := testConfig([]string{bad.URL, ok.URL}, withRetries, withRPCErrorCodes, withBreaker)
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+
+	for i := 0; i < 50; i++ {
+		assert.JSONEq(t, `{"jsonrpc":"2.0","result":7,"id":1}`, forwardCall(f, blockNumberCall).Body.String(), "failed over to the healthy backend")
+	}
+
+	b := lb.Snapshot().Backend(bad.URL)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&badHits), "cut off by the breaker")
+	assert.Equal(t, int64(3), b.RequestStats.TotalErrors)
+	assert.Zero(t, b.RequestStats.LatencySamples, "failing fast does not make a backend look fast")
+	assert.Equal(t, CircuitOpen, b.Circuit)
+	assert.Equal(t, int32(50), atomic.LoadInt32(&okHits))
+}
+
+func TestForwarder_FailedStatusesCountAsErrors(t *testing.T) {
+	var badHits, okHits int32
+	bad := statusBackend(&badHits, http.StatusServiceUnavailable)
+	defer bad.Close()
+	ok := cannedBackend(&okHits, `"result":7`)
+	defer ok.Close()
+
+	cfg := testConfig([]string{bad.URL, ok.URL}, withRetries, withRPCErrorCodes, withBreaker)
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+
+	for i := 0; i < 50; i++ {
+		assert.JSONEq(t, `{"jsonrpc":"2.0","result":7,"id":1}`, forwardCall(f, blockNumberCall).Body.String(), "failed over to the healthy backend")
+	}
+
+	b := lb.Snapshot().Backend(bad.URL)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&badHits), "cut off by the breaker")
+	assert.Equal(t, int64(3), b.RequestStats.TotalRequests)
+	assert.Equal(t, int64(3), b.RequestStats.TotalErrors, "stats agree with the breaker")
+	assert.Zero(t, b.RequestStats.LatencySamples, "failing fast does not make a backend look fast")
+	assert.Equal(t, CircuitOpen, b.Circuit)
+}
+
+func TestForwarder_BackendRPCErrorsFailOverOnce(t *testing.T) {
+	var hits int32
+	node1 := cannedBackend(&hits, rpcError("-32603"))
+	defer node1.Close()
+	node2 := cannedBackend(&hits, rpcError("-32603"))
+	defer node2.Close()
+	node3 := cannedBackend(&hits, rpcError("-32603"))
+	defer node3.Close()
+
+	cfg := testConfig([]string{node1.URL, node2.URL, node3.URL}, withRetries, withRPCErrorCodes)
+	f := NewRequestForwarder(cfg, NewLoadBalancer(cfg))
+
+	assert.Contains(t, forwardCall(f, blockNumberCall).Body.String(), `"code":-32603`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits), "a call failing everywhere costs one extra attempt")
+
+	atomic.StoreInt32(&hits, 0)
+	w := forwardCall(f, `{"jsonrpc":"2.0","method":"node_sendTx","params":[],"id":1}`)
+	assert.Contains(t, w.Body.String(), `"code":-32603`)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "methods that are not replay-safe are never failed over")
+}
+
+func TestForwarder_RetryableRPCErrorsFailOver(t *testing.T) {
+	var busyHits, okHits int32
+	busy := cannedBackend(&busyHits, rpcError("-32005"))
+	defer busy.Close()
+	ok := cannedBackend(&okHits, `"result":7`)
+	defer ok.Close()
+
+	cfg := testConfig([]string{busy.URL, ok.URL}, withRetries, withRPCErrorCodes)
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+
+	for i := 0; i < 20; i++ {
+		assert.JSONEq(t, `{"jsonrpc":"2.0","result":7,"id":1}`, forwardCall(f, blockNumberCall).Body.String())
+	}
+	assert.Equal(t, int32(20), atomic.LoadInt32(&okHits))
+	assert.Equal(t, int64(atomic.LoadInt32(&busyHits)), lb.Snapshot().Backend(busy.URL).RequestStats.TotalErrors)
+}
+
+func TestForwarder_ClientRPCErrorsAreAnswers(t *testing.T) {
+	var hits int32
+	backend := cannedBackend(&hits, rpcError("-32602"))
+	defer backend.Close()
+
+	cfg := testConfig([]string{backend.URL}, withRetries, withRPCErrorCodes, withBreaker)
+	lb := NewLoadBalancer(cfg)
+	f := NewRequestForwarder(cfg, lb)
+
+	for i := 0; i < 10; i++ {
+		assert.Contains(t, forwardCall(f, blockNumberCall).Body.String(), `"code":-32602`)
+	}
+
+	b := lb.Snapshot().Backends[0]
+	assert.Equal(t, int32(10), atomic.LoadInt32(&hits), "not retried")
+	assert.Zero(t, b.RequestStats.TotalErrors)
+	assert.Equal(t, CircuitClosed, b.Circuit)
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+)
+
+// sessionStore remembers the highest block each client session has observed so
+// the session is never routed to a backend behind it. Entries expire after ttl
+// and the least recently used session is dropped once max is reached.
+type sessionStore struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type sessionEntry struct {
+	key     string
+	block   int
+	expires time.Time
+}
+
+func newSessionStore(ttl time.Duration, max int) *sessionStore {
+	return &sessionStore{
+		ttl:   ttl,
+		max:   max,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// observed returns the highest block seen by a session, or 0 for unknown or
+// expired sessions.
+func (s *sessionStore) observed(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return 0
+	}
+	e := el.Value.(*sessionEntry)
+	if s.now().After(e.expires) {
+		s.remove(el)
+		return 0
+	}
+	return e.block
+}
+
+// observe raises the session's high-water mark to block and refreshes its expiry.
+func (s *sessionStore) observe(key string, block int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires := s.now().Add(s.ttl)
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*sessionEntry)
+		if s.now().After(e.expires) {
+			e.block = 0
+		}
+		if block > e.block {
+			e.block = block
+		}
+		e.expires = expires
+		s.ll.MoveToFront(el)
+		return
+	}
+
+	s.items[key] = s.ll.PushFront(&sessionEntry{key: key, block: block, expires: expires})
+	for s.max > 0 && s.ll.Len() > s.max {
+		s.remove(s.ll.Back())
+	}
+	metrics.SetSessions(s.ll.Len())
+}
+
+// reset forgets every session, e.g. after a reorg made their blocks unreachable.
+func (s *sessionStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ll.Init()
+	s.items = make(map[string]*list.Element)
+	metrics.SetSessions(0)
+}
+
+func (s *sessionStore) remove(el *list.Element) {
+	s.ll.Remove(el)
+	delete(s.items, el.Value.(*sessionEntry).key)
+	metrics.SetSessions(s.ll.Len())
+}
+
+// sessionKey identifies the client session of a request by API key, session
+// header or session cookie, in that order. It returns "" for anonymous requests.
+// Client values are kept as digests: API keys are credentials, and every key
+// has the same size however large the value a client sends.
+func sessionKey(cfg *config.Config, r *http.Request) string {
+	if cfg.SessionAPIKeyHeader != "" {
+		if v := r.Header.Get(cfg.SessionAPIKeyHeader); v != "" {
+			return "key:" + digest(v)
+		}
+	}
+	if cfg.SessionHeader != "" {
+		if v := r.Header.Get(cfg.SessionHeader); v != "" {
+			return "header:" + digest(v)
+		}
+	}
+	if cfg.SessionCookie != "" {
+		if c, err := r.Cookie(cfg.SessionCookie); err == nil && c.Value != "" {
+			return "cookie:" + digest(c.Value)
+		}
+	}
+	return ""
+}
+
+// digest returns the hex-encoded SHA-256 of a client-supplied value.
+func digest(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// joinSession raises the request's minimum block to what its session has
+// already observed.
+func (f *Forwarder) joinSession(r *http.Request, c *consistency) {
+	if f.sessions == nil {
+		return
+	}
+	c.session = sessionKey(f.cfg, r)
+	if c.session == "" {
+		return
+	}
+	if block := f.sessions.observed(c.session); block > c.minBlock {
+		c.minBlock = block
+	}
+}
+
+// observeBlock records the block a response was served at for the request's session.
+func (f *Forwarder) observeBlock(r *http.Request, block int) {
+	if f.sessions == nil || block <= 0 {
+		return
+	}
+	if key := consistencyFrom(r.Context()).session; key != "" {
+		f.sessions.observe(key, block)
+	}
+}
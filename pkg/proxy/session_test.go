@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionStore_HighWaterMark(t *testing.T) {
+	s := newSessionStore(time.Minute, 10)
+
+	s.observe("a", 100)
+	s.observe("a", 90)
+	assert.Equal(t, 100, s.observed("a"), "observed block never goes backwards")
+
+	s.observe("a", 110)
+	assert.Equal(t, 110, s.observed("a"))
+	assert.Equal(t, 0, s.observed("b"))
+}
+
+func TestSessionStore_Expiry(t *testing.T) {
+	now := time.Now()
+	s := newSessionStore(time.Minute, 10)
+	s.now = func() time.Time { return now }
+
+	s.observe("a", 100)
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 0, s.observed("a"))
+	assert.Empty(t, s.items, "expired sessions are dropped on access")
+
+	s.observe("b", 100)
+	now = now.Add(2 * time.Minute)
+	s.observe("b", 50)
+	assert.Equal(t, 50, s.observed("b"), "an expired session starts over")
+}
+
+func TestSessionStore_Bounded(t *testing.T) {
+	s := newSessionStore(time.Minute, 2)
+
+	s.observe("a", 1)
+	s.observe("b", 2)
+	s.observed("a") // a is now more recently used than b
+	s.observe("a", 1)
+	s.observe("c", 3)
+
+	assert.Equal(t, 2, s.ll.Len())
+	assert.Equal(t, 0, s.observed("b"), "least recently used session is dropped")
+	assert.Equal(t, 1, s.observed("a"))
+}
+
+func TestForwarder_MonotonicReads(t *testing.T) {
+	f, lb, hits := freshnessPool(t, 100, 120)
+	f.cfg.SessionHeader = "X-Sentinel-Session"
+	f.sessions = newSessionStore(time.Minute, 100)
+
+	// Serve the session from the backend at 120 only
+	lb.UpdateBackendStateByUrl(lb.backends[0].URL, func(b *Backend) { b.Healthy = false })
+	w := httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{"X-Sentinel-Session": "s1"}))
+	assert.Equal(t, "120", w.Header().Get(HeaderBackendBlock))
+
+	// Both are healthy again: the session must not go back to block 100
+	lb.UpdateBackendStateByUrl(lb.backends[0].URL, func(b *Backend) { b.Healthy = true })
+	for i := 0; i < 10; i++ {
+		f.Forward(httptest.NewRecorder(), freshRequest(map[string]string{"X-Sentinel-Session": "s1"}))
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(hits[0]))
+
+	// Only the stale backend is left
+	lb.UpdateBackendStateByUrl(lb.backends[1].URL, func(b *Backend) { b.Healthy = false })
+	w = httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{"X-Sentinel-Session": "s1"}))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// Other sessions are unaffected
+	w = httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{"X-Sentinel-Session": "s2"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits[0]))
+}
+
+func TestSessionKey_Sources(t *testing.T) {
+	f, _, _ := freshnessPool(t, 1)
+	f.cfg.SessionAPIKeyHeader = "X-Api-Key"
+	f.cfg.SessionHeader = "X-Sentinel-Session"
+	f.cfg.SessionCookie = "sentinel_session"
+
+	r := freshRequest(map[string]string{"X-Api-Key": "secret", "X-Sentinel-Session": "s1"})
+	key := sessionKey(f.cfg, r)
+	assert.NotContains(t, key, "secret", "API keys are not kept in memory as-is")
+
+	r = freshRequest(map[string]string{"X-Sentinel-Session": strings.Repeat("s", 8<<10)})
+	key = sessionKey(f.cfg, r)
+	assert.True(t, strings.HasPrefix(key, "header:"))
+	assert.Len(t, key, len("header:")+64, "large session values are not kept as-is")
+
+	r = freshRequest(nil)
+	r.AddCookie(&http.Cookie{Name: "sentinel_session", Value: "c1"})
+	assert.Equal(t, "cookie:"+digest("c1"), sessionKey(f.cfg, r))
+
+	assert.Equal(t, "", sessionKey(f.cfg, freshRequest(nil)))
+}
@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyWindow is how long latency samples count towards the stats. Samples
+// are kept for between one and two windows.
+const LatencyWindow = time.Minute
+
+const (
+	sketchGamma   = 1.04             // Bucket growth factor: quantiles are within 2% of the true value
+	sketchMin     = time.Microsecond // Lower bound of the first bucket
+	sketchBuckets = 512              // Covers sketchMin to about 8 minutes
+	sketchShards  = 8                // Most shards a sketch is split into
+)
+
+var sketchLogGamma = math.Log(sketchGamma)
+
+// sketchShardLimit bounds the shards of a sketch on this machine: no more
+// shards can be recorded into at once than threads run Go code.
+var sketchShardLimit = min(runtime.GOMAXPROCS(0), sketchShards)
+
+// latencySketch is a constant-memory latency histogram with logarithmically
+// sized buckets, so every quantile is read with the same relative accuracy
+// whatever the latency range. Samples go into the current period; stats are
+// read from the current and the previous period, so old samples age out
+// without being stored individually.
+//
+// Requests record concurrently, so the sketch is split into independently
+// locked shards that reads merge. It starts with one shard and adds another
+// only when recording finds all of them busy, so a sketch that is not
+// contended stays small.
+type latencySketch struct {
+	shards [sketchShards]atomic.Pointer[sketchShard]
+	n      atomic.Int32 // Shards in use
+	grow   sync.Mutex   // Serializes adding shards
+}
+
+type sketchShard struct {
+	mu      sync.Mutex
+	cur     sketchPeriod
+	prev    sketchPeriod
+	started time.Time // Start of the current period
+	total   int64     // Samples ever recorded
+}
+
+type sketchPeriod struct {
+	counts   [sketchBuckets]uint32
+	count    int64
+	sum      time.Duration
+	min, max time.Duration
+}
+
+// latencySummary is the state of a sketch at one point in time.
+type latencySummary struct {
+	count         int64
+	avg, min, max time.Duration
+	p50, p90, p99 time.Duration
+}
+
+// record adds a sample taken at now.
+func (s *latencySketch) record(d time.Duration, now time.Time) {
+	sh := s.lockShard()
+	defer sh.mu.Unlock()
+	sh.rotate(now)
+	sh.cur.add(d)
+	sh.total++
+}
+
+// lockShard locks and returns a shard to record into. It tries the shards in
+// use from a random one on and adds a shard when all of them are busy.
+func (s *latencySketch) lockShard() *sketchShard {
+	n := int(s.n.Load())
+	if n == 0 {
+		if sh := s.addShard(0); sh != nil {
+			return sh
+		}
+		n = int(s.n.Load())
+	}
+	first := rand.Intn(n)
+	for i := range n {
+		if sh := s.shards[(first+i)%n].Load(); sh.mu.TryLock() {
+			return sh
+		}
+	}
+	if n < sketchShardLimit {
+		if sh := s.addShard(n); sh != nil {
+			return sh
+		}
+	}
+	sh := s.shards[first].Load()
+	sh.mu.Lock()
+	return sh
+}
+
+// addShard adds shard n locked, unless another caller added it first.
+func (s *latencySketch) addShard(n int) *sketchShard {
+	s.grow.Lock()
+	defer s.grow.Unlock()
+	if int(s.n.Load()) != n {
+		return nil
+	}
+	sh := &sketchShard{}
+	sh.mu.Lock()
+	s.shards[n].Store(sh)
+	s.n.Store(int32(n + 1))
+	return sh
+}
+
+// each calls fn with every shard in use, locked and rotated to now.
+func (s *latencySketch) each(now time.Time, fn func(*sketchShard)) {
+	for i := range int(s.n.Load()) {
+		sh := s.shards[i].Load()
+		sh.mu.Lock()
+		sh.rotate(now)
+		fn(sh)
+		sh.mu.Unlock()
+	}
+}
+
+// rotate starts a new period once the current one is LatencyWindow old.
+// Caller holds sh.mu.
+func (sh *sketchShard) rotate(now time.Time) {
+	if sh.started.IsZero() {
+		sh.started = now
+		return
+	}
+	elapsed := now.Sub(sh.started)
+	switch {
+	case elapsed < LatencyWindow:
+		return
+	case elapsed < 2*LatencyWindow:
+		sh.prev = sh.cur
+	default:
+		sh.prev = sketchPeriod{} // Idle for a whole period
+	}
+	sh.cur = sketchPeriod{}
+	sh.started = now
+}
+
+// window returns the samples of the window merged across shards.
+func (s *latencySketch) window(now time.Time) *sketchPeriod {
+	w := &sketchPeriod{}
+	s.each(now, func(sh *sketchShard) {
+		w.merge(&sh.cur)
+		w.merge(&sh.prev)
+	})
+	return w
+}
+
+// quantile returns the q-th quantile (0-1) of the window.
+func (s *latencySketch) quantile(q float64, now time.Time) time.Duration {
+	return s.window(now).quantile(q)
+}
+
+// count returns the number of samples in the window.
+func (s *latencySketch) count(now time.Time) int64 {
+	var n int64
+	s.each(now, func(sh *sketchShard) { n += sh.cur.count + sh.prev.count })
+	return n
+}
+
+// total returns the number of samples ever recorded.
+func (s *latencySketch) total() int64 {
+	var n int64
+	s.each(time.Now(), func(sh *sketchShard) { n += sh.total })
+	return n
+}
+
+// summary returns the stats of the window.
+func (s *latencySketch) summary(now time.Time) latencySummary {
+	w := s.window(now)
+	if w.count == 0 {
+		return latencySummary{}
+	}
+	return latencySummary{
+		count: w.count,
+		avg:   w.sum / time.Duration(w.count),
+		min:   w.min,
+		max:   w.max,
+		p50:   w.quantile(0.50),
+		p90:   w.quantile(0.90),
+		p99:   w.quantile(0.99),
+	}
+}
+
+// copyTo copies the window of the sketch into dst, which must be unused.
+func (s *latencySketch) copyTo(dst *latencySketch, now time.Time) {
+	c := &sketchShard{started: now}
+	s.each(now, func(sh *sketchShard) {
+		c.cur.merge(&sh.cur)
+		c.cur.merge(&sh.prev)
+		c.total += sh.total
+	})
+	dst.shards[0].Store(c)
+	dst.n.Store(1)
+}
+
+// add adds a sample to the period.
+func (p *sketchPeriod) add(d time.Duration) {
+	if p.count == 0 || d < p.min {
+		p.min = d
+	}
+	if p.count == 0 || d > p.max {
+		p.max = d
+	}
+	p.counts[sketchBucket(d)]++
+	p.count++
+	p.sum += d
+}
+
+// merge adds the samples of o to the period.
+func (p *sketchPeriod) merge(o *sketchPeriod) {
+	if o.count == 0 {
+		return
+	}
+	if p.count == 0 || o.min < p.min {
+		p.min = o.min
+	}
+	if p.count == 0 || o.max > p.max {
+		p.max = o.max
+	}
+	for i, c := range o.counts {
+		p.counts[i] += c
+	}
+	p.count += o.count
+	p.sum += o.sum
+}
+
+// quantile returns the q-th quantile of the period. The extremes are tracked
+// exactly, and the result is clamped to them.
+func (p *sketchPeriod) quantile(q float64) time.Duration {
+	if p.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(p.count)))
+	switch {
+	case rank <= 1:
+		return p.min
+	case rank >= p.count:
+		return p.max
+	}
+
+	var seen int64
+	for i, c := range p.counts {
+		seen += int64(c)
+		if seen >= rank {
+			if i == sketchBuckets-1 {
+				return p.max // Overflow bucket
+			}
+			return min(max(sketchValue(i), p.min), p.max)
+		}
+	}
+	return p.max
+}
+
+// sketchBucket returns the bucket holding d: bucket i covers
+// (sketchMin*gamma^(i-1), sketchMin*gamma^i].
+func sketchBucket(d time.Duration) int {
+	if d <= sketchMin {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(sketchMin)) / sketchLogGamma))
+	return min(i, sketchBuckets-1)
+}
+
+// sketchValue returns the value reported for samples in bucket i, the one
+// with the lowest relative error across the bucket.
+func sketchValue(i int) time.Duration {
+	if i == 0 {
+		return sketchMin
+	}
+	upper := float64(sketchMin) * math.Pow(sketchGamma, float64(i))
+	return time.Duration(2 * upper / (sketchGamma + 1))
+}
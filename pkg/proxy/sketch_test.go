@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencySketch_Quantiles(t *testing.T) {
+	var s latencySketch
+	now := time.Now()
+	for i := 1000; i >= 1; i-- {
+		s.record(time.Duration(i)*time.Millisecond, now)
+	}
+
+	l := s.summary(now)
+	assert.Equal(t, int64(1000), l.count)
+	assert.Equal(t, time.Millisecond, l.min)
+	assert.Equal(t, time.Second, l.max)
+	assert.Equal(t, 500500*time.Microsecond, l.avg)
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(l.p50), 0.02)
+	assert.InEpsilon(t, float64(900*time.Millisecond), float64(l.p90), 0.02)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(l.p99), 0.02)
+}
+
+func TestLatencySketch_ClampsToExtremes(t *testing.T) {
+	var s latencySketch
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		s.record(42*time.Millisecond, now)
+	}
+	assert.Equal(t, 42*time.Millisecond, s.quantile(0.5, now), "a single value is reported exactly")
+
+	s.record(time.Hour, now) // Beyond the last bucket
+	s.record(time.Hour, now)
+	assert.Equal(t, time.Hour, s.quantile(0.9, now))
+	s.record(0, now)
+	assert.Equal(t, time.Duration(0), s.quantile(0, now))
+}
+
+func TestLatencySketch_GrowsShardsUnderContention(t *testing.T) {
+	defer func(limit int) { sketchShardLimit = limit }(sketchShardLimit)
+	sketchShardLimit = 4
+
+	var s latencySketch
+	now := time.Now()
+	s.record(10*time.Millisecond, now)
+	s.record(20*time.Millisecond, now)
+	assert.Equal(t, int32(1), s.n.Load(), "uncontended recording stays on one shard")
+
+	busy := s.shards[0].Load()
+	busy.mu.Lock()
+	s.record(30*time.Millisecond, now)
+	busy.mu.Unlock()
+	assert.Equal(t, int32(2), s.n.Load())
+
+	l := s.summary(now)
+	assert.Equal(t, int64(3), l.count, "reads merge every shard")
+	assert.Equal(t, 10*time.Millisecond, l.min)
+	assert.Equal(t, 30*time.Millisecond, l.max)
+	assert.Equal(t, int64(3), s.total())
+}
+
+func TestLatencySketch_ConcurrentRecording(t *testing.T) {
+	var s latencySketch
+	now := time.Now()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 1000; i++ {
+				s.record(time.Duration(i)*time.Millisecond, now)
+			}
+		}()
+	}
+	wg.Wait()
+
+	l := s.summary(now)
+	assert.Equal(t, int64(8000), l.count)
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(l.p50), 0.02)
+}
+
+func TestLatencySketch_Window(t *testing.T) {
+	var s latencySketch
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		s.record(100*time.Millisecond, start)
+	}
+
+	// The previous period still counts
+	next := start.Add(LatencyWindow)
+	for i := 0; i < 10; i++ {
+		s.record(10*time.Millisecond, next)
+	}
+	assert.Equal(t, int64(20), s.count(next))
+	assert.Equal(t, 100*time.Millisecond, s.summary(next).max)
+
+	// Two periods later it is gone
+	later := next.Add(LatencyWindow)
+	assert.Equal(t, int64(10), s.count(later))
+	assert.Equal(t, 10*time.Millisecond, s.quantile(0.99, later))
+
+	// After a long idle time nothing is left
+	assert.Zero(t, s.count(later.Add(2*LatencyWindow)))
+	assert.Equal(t, latencySummary{}, s.summary(later.Add(2*LatencyWindow)))
+}
+
+func TestUpdateBackendHealth_SeparatesHealthLatency(t *testing.T) {
+	lb := testPool(1)
+	lb.UpdateBackendHealth("http://node1", true, 100, 300*time.Millisecond)
+	lb.UpdateBackendHealth("http://node1", false, 0, 5*time.Second)
+
+	b := lb.Snapshot().Backends[0]
+	assert.Zero(t, b.RequestStats.LatencySamples, "health checks are not traffic")
+	assert.Equal(t, int64(2), b.HealthStats.TotalRequests)
+	assert.Equal(t, int64(1), b.HealthStats.TotalErrors)
+	assert.Equal(t, int64(1), b.HealthStats.LatencySamples, "failed checks carry no latency")
+	assert.Equal(t, 300*time.Millisecond, b.HealthStats.P50Latency)
+
+	live := lb.backends[0]
+	lb.IncSuccessfulRequest(live, 200, 20*time.Millisecond)
+	metrics.LearnMethod("node_getBlock")
+	lb.RecordMethodLatency("node_getBlock", 20*time.Millisecond)
+
+	snap := lb.Snapshot()
+	assert.Equal(t, 20*time.Millisecond, snap.Backends[0].RequestStats.P99Latency)
+	assert.Equal(t, 20*time.Millisecond, snap.Methods["node_getBlock"].P50Latency)
+	assert.Equal(t, 20*time.Millisecond, live.medianLatency(), "traffic latency wins over health checks")
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Slow start curves accepted in SLOW_START_CURVE.
+const (
+	SlowStartLinear      = "linear"
+	SlowStartExponential = "exponential"
+)
+
+// minSlowStartWeight keeps a ramping backend reachable when no minimum weight
+// is configured.
+const minSlowStartWeight = 0.01
+
+// slowStart is the weight ramp of a new or recovering backend. It is never modified
+// once created, so selection reads it without locking.
+type slowStart struct {
+	until  time.Time
+	window time.Duration
+	curve  string
+	floor  float64 // Share of the full weight at the start of the window
+}
+
+// weight returns the share of its full weight the backend gets at now.
+func (s *slowStart) weight(now time.Time) float64 {
+	if s == nil {
+		return 1
+	}
+	remaining := s.until.Sub(now)
+	if remaining <= 0 {
+		return 1
+	}
+	return rampWeight(s.curve, s.floor, 1-float64(remaining)/float64(s.window))
+}
+
+// progress returns the share of its full weight the backend gets at now and
+// when the ramp ends, for reporting; 0 and the zero time once it has ended.
+func (s *slowStart) progress(now time.Time) (float64, time.Time) {
+	if s == nil || !now.Before(s.until) {
+		return 0, time.Time{}
+	}
+	return s.weight(now), s.until
+}
+
+// beginSlowStart starts ramping up the weight of a backend that just became
+// healthy, either by joining the pool or by recovering, so it is not handed
+// its full share while its caches are cold. Caller holds lb.mu or owns b.
+func (lb *LoadBalancer) beginSlowStart(b *Backend, now time.Time) {
+	if lb.cfg.SlowStartWindow <= 0 {
+		return
+	}
+	b.ramp = &slowStart{
+		until:  now.Add(lb.cfg.SlowStartWindow),
+		window: lb.cfg.SlowStartWindow,
+		curve:  lb.cfg.SlowStartCurve,
+		floor:  slowStartFloor(lb.cfg.SlowStartMinWeightPercent),
+	}
+	log.Info().Str("url", b.URL).Dur("window", lb.cfg.SlowStartWindow).Msg("Backend slow start")
+}
+
+// endSlowStart drops the ramp of b once its window has passed. Selection and
+// snapshots compute the weight from the ramp's own clock, so this only
+// releases it; the health loop calls it and publishes. Caller holds lb.mu.
+func (lb *LoadBalancer) endSlowStart(b *Backend, now time.Time) {
+	if b.ramp == nil || now.Before(b.ramp.until) {
+		return
+	}
+	b.ramp = nil
+	log.Info().Str("url", b.URL).Msg("Backend slow start complete")
+}
+
+func slowStartFloor(minPercent int) float64 {
+	return math.Max(float64(minPercent)/100, minSlowStartWeight)
+}
+
+// rampWeight returns the weight share at the given progress from floor to 1.
+// The linear curve adds the same weight every second; the exponential curve
+// multiplies it, so the backend stays lightly loaded for most of the window
+// and catches up at the end.
+func rampWeight(curve string, floor, progress float64) float64 {
+	if floor >= 1 {
+		return 1
+	}
+	progress = math.Min(math.Max(progress, 0), 1)
+	if curve == SlowStartExponential {
+		return math.Pow(floor, 1-progress)
+	}
+	return floor + (1-floor)*progress
+}
+
+// slowStartShare returns the share of its full weight b currently gets.
+func (b *Backend) slowStartShare() float64 {
+	if b.ramp == nil {
+		return 1
+	}
+	return b.ramp.weight(time.Now())
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowStart_RampsNewBackends(t *testing.T) {
+	lb := testPool(2, withSlowStart(SlowStartLinear))
+	for _, snap := range lb.Snapshot().Backends {
+		assert.InDelta(t, 0.1, snap.SlowStart, 1e-3, "backends joining the pool are ramped")
+		assert.False(t, snap.SlowStartUntil.IsZero())
+	}
+}
+
+func TestSlowStart_RampsAfterRecovery(t *testing.T) {
+	lb := testPool(2, withSlowStart(SlowStartLinear))
+	b := lb.backends[0]
+
+	lb.UpdateBackendHealth("http://node1", false, 0, 0)
+	lb.UpdateBackendHealth("http://node1", true, 100, 0)
+	snap := lb.Snapshot().Backend("http://node1")
+	assert.InDelta(t, 0.1, snap.SlowStart, 1e-3)
+	start := snap.SlowStartUntil.Add(-10 * time.Second)
+
+	share, until := b.ramp.progress(start.Add(5 * time.Second))
+	assert.InDelta(t, 0.55, share, 1e-9)
+	assert.Equal(t, snap.SlowStartUntil, until)
+
+	share, until = b.ramp.progress(start.Add(10 * time.Second))
+	assert.Zero(t, share, "an elapsed ramp is reported as over before the health loop drops it")
+	assert.True(t, until.IsZero())
+
+	// The next passing check drops the ramp and publishes it
+	gen := lb.Snapshot().Generation
+	lb.mu.Lock()
+	b.ramp.until = time.Now()
+	lb.mu.Unlock()
+	lb.UpdateBackendHealth("http://node1", true, 100, 0)
+	assert.Nil(t, b.ramp)
+	assert.Nil(t, lb.current().byURL["http://node1"].ramp, "the routing view drops the ramp too")
+	assert.Greater(t, lb.Snapshot().Generation, gen)
+}
+
+func TestSlowStart_ExponentialCurve(t *testing.T) {
+	lb := testPool(2, withSlowStart(SlowStartExponential))
+	b := lb.backends[0]
+
+	lb.UpdateBackendHealth("http://node1", false, 0, 0)
+	lb.UpdateBackendHealth("http://node1", true, 100, 0)
+	start := b.ramp.until.Add(-10 * time.Second)
+
+	assert.InDelta(t, 0.1, b.ramp.weight(start), 1e-9)
+	assert.InDelta(t, 0.316, b.ramp.weight(start.Add(5*time.Second)), 1e-3)
+	assert.InDelta(t, 1, b.ramp.weight(start.Add(10*time.Second)), 1e-9)
+}
+
+func TestSlowStart_Disabled(t *testing.T) {
+	lb := testPool(1)
+
+	lb.UpdateBackendHealth("http://node1", false, 0, 0)
+	lb.UpdateBackendHealth("http://node1", true, 100, 0)
+	assert.Nil(t, lb.backends[0].ramp)
+	assert.Zero(t, lb.Snapshot().Backends[0].SlowStart)
+}
+
+func TestSlowStart_ScalesWeightedShare(t *testing.T) {
+	candidates := []*Backend{
+		{URL: "warm", IntegrityStats: &IntegrityStats{Priority: 100}},
+		{URL: "cold", IntegrityStats: &IntegrityStats{Priority: 100}, ramp: &slowStart{until: time.Now().Add(time.Hour), window: time.Hour, floor: 0.1}},
+	}
+
+	rnd := seeded()
+	counts := map[string]int{}
+	for i := 0; i < 11000; i++ {
+		counts[pickWeighted(candidates, rnd.Float64).URL]++
+	}
+	// Weights 10 and 1
+	assert.InDelta(t, 1000, counts["cold"], 150)
+}
+
+func TestSlowStart_AppliesToEveryStrategy(t *testing.T) {
+	ramp := &slowStart{until: time.Now().Add(time.Hour), window: time.Hour, floor: 0.1}
+	candidates := []*Backend{
+		{URL: "warm", IntegrityStats: &IntegrityStats{Priority: 100}, load: newBackendLoad(time.Second)},
+		{URL: "cold", IntegrityStats: &IntegrityStats{Priority: 100}, load: newBackendLoad(time.Second), ramp: ramp},
+	}
+	for _, b := range candidates {
+		b.load.observe(10 * time.Millisecond) // Equal latency, so p2c compares the ramp
+	}
+
+	for _, name := range []string{StrategyWeighted, StrategyRoundRobin, StrategyLeastOutstanding, StrategyP2CEWMA, StrategyConsistentHash} {
+		s, err := NewStrategy(name, seeded())
+		assert.NoError(t, err)
+		cold := 0
+		for i := 0; i < 2000; i++ {
+			if s.Pick(candidates, strconv.Itoa(i)).URL == "cold" {
+				cold++
+			}
+		}
+		assert.Less(t, cold, 500, "%s hands a ramping backend its full share", name)
+	}
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is a point-in-time copy of the pool state. It shares nothing with
+// the load balancer, so it can be read, encoded and kept while the pool keeps
+// changing.
+type Snapshot struct {
+	Generation    uint64 // Increases with every change to the pool state
+	Backends      []*Backend
+	BestBlock     int
+	ChainTips     ChainTips
+	TargetVersion string
+	Methods       map[string]*RequestStats // Latency per JSON-RPC method
+}
+
+// Snapshot returns deep copies of all backends along with the pool-wide
+// state they were taken with. Request counters and latency windows keep
+// changing between generations; their copies are consistent per backend.
+func (lb *LoadBalancer) Snapshot() Snapshot {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	s := Snapshot{
+		Generation:    lb.generation,
+		Backends:      make([]*Backend, 0, len(lb.backends)),
+		BestBlock:     lb.bestBlock,
+		ChainTips:     lb.tips,
+		TargetVersion: lb.targetVersion,
+	}
+	for _, b := range lb.backends {
+		s.Backends = append(s.Backends, b.clone())
+	}
+	lb.methodStats.Range(func(method, rs any) bool {
+		if s.Methods == nil {
+			s.Methods = make(map[string]*RequestStats)
+		}
+		c := rs.(*RequestStats).clone()
+		c.TotalRequests = c.latency.total() // Method stats count through their sketch
+		s.Methods[method.(string)] = c
+		return true
+	})
+	return s
+}
+
+// Backend returns the backend with the given URL, or nil if the snapshot has
+// none.
+func (s Snapshot) Backend(url string) *Backend {
+	for _, b := range s.Backends {
+		if b.URL == url {
+			return b
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy of the exported state of b. The live load,
+// breaker and ramp are left out. Caller holds lb.mu.
+func (b *Backend) clone() *Backend {
+	c := &Backend{
+		URL:             b.URL,
+		Healthy:         b.Healthy,
+		BlockNumber:     b.BlockNumber,
+		Lag:             b.Lag,
+		Lagging:         b.Lagging,
+		OldestBlock:     b.OldestBlock,
+		LastChecked:     b.LastChecked,
+		HealthFailures:  b.HealthFailures,
+		HealthSuccesses: b.HealthSuccesses,
+		NodeType:        b.NodeType,
+		NodeVersion:     b.NodeVersion,
+		ProtocolVersion: b.ProtocolVersion,
+		VersionMismatch: b.VersionMismatch,
+		Circuit:         b.Circuit,
+		Ejected:         b.Ejected,
+		EjectedUntil:    b.EjectedUntil,
+		Ejections:       b.Ejections,
+	}
+	c.SlowStart, c.SlowStartUntil = b.ramp.progress(time.Now())
+	c.UnsupportedMethods = maps.Clone(b.UnsupportedMethods)
+	if b.IntegrityStats != nil {
+		is := *b.IntegrityStats
+		is.MissingEpochs = slices.Clone(is.MissingEpochs)
+		is.InconsistentEpochs = slices.Clone(is.InconsistentEpochs)
+		c.IntegrityStats = &is
+	}
+	if b.EpochStats != nil {
+		es := *b.EpochStats
+		c.EpochStats = &es
+	}
+	if b.RequestStats != nil {
+		c.RequestStats = b.RequestStats.clone()
+	}
+	if b.HealthStats != nil {
+		c.HealthStats = b.HealthStats.clone()
+	}
+	return c
+}
+
+// clone returns a copy of the stats with the latency fields filled in.
+func (rs *RequestStats) clone() *RequestStats {
+	c := &RequestStats{
+		TotalRequests: atomic.LoadInt64(&rs.TotalRequests),
+		TotalErrors:   atomic.LoadInt64(&rs.TotalErrors),
+	}
+	now := time.Now()
+	rs.latency.copyTo(&c.latency, now)
+
+	l := c.latency.summary(now)
+	c.AvgLatency, c.MinLatency, c.MaxLatency = l.avg, l.min, l.max
+	c.P50Latency, c.P90Latency, c.P99Latency = l.p50, l.p90, l.p99
+	c.LatencySamples = l.count
+	return c
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot_DeepCopy(t *testing.T) {
+	lb := NewLoadBalancer(&config.Config{SentinelBackends: []string{"http://node1"}})
+	lb.UpdateIntegrityScore("http://node1", 90, []int64{7}, nil)
+	lb.MarkMethodUnsupported(lb.backends[0], "node_getBlock")
+	lb.IncSuccessfulRequest(lb.backends[0], 200, time.Millisecond)
+
+	snap := lb.Snapshot()
+	b := snap.Backend("http://node1")
+	assert.Equal(t, 90, b.IntegrityStats.Score)
+	assert.Equal(t, []int64{7}, b.IntegrityStats.MissingEpochs)
+	assert.True(t, b.UnsupportedMethods["node_getBlock"])
+	assert.Equal(t, int64(1), b.RequestStats.TotalRequests)
+
+	// Changing the copy leaves the pool alone
+	b.Healthy = false
+	b.IntegrityStats.MissingEpochs[0] = 8
+	b.UnsupportedMethods["node_getBlockHeader"] = true
+	b.RequestStats.recordLatency(time.Second)
+	live := lb.backends[0]
+	assert.True(t, live.Healthy)
+	assert.Equal(t, []int64{7}, live.IntegrityStats.MissingEpochs)
+	assert.False(t, live.UnsupportedMethods["node_getBlockHeader"])
+	assert.Equal(t, 1, live.RequestStats.samples())
+
+	// Changing the pool leaves the copy alone
+	lb.UpdateIntegrityScore("http://node1", 50, nil, nil)
+	lb.IncErrorRequest(live)
+	assert.Equal(t, 90, b.IntegrityStats.Score)
+	assert.Equal(t, int64(1), b.RequestStats.TotalRequests)
+	assert.Nil(t, snap.Backend("http://node2"))
+}
+
+func TestSnapshot_Generation(t *testing.T) {
+	lb := NewLoadBalancer(&config.Config{SentinelBackends: []string{"http://node1"}})
+
+	first := lb.Snapshot().Generation
+	assert.Equal(t, first, lb.Snapshot().Generation, "unchanged pool, same generation")
+
+	lb.UpdateBackendHealth("http://node1", true, 100, time.Millisecond)
+	second := lb.Snapshot()
+	assert.Greater(t, second.Generation, first)
+	assert.Equal(t, 100, second.BestBlock)
+
+	lb.MarkBlockPruned(second.Backends[0], 10)
+	assert.Greater(t, lb.Snapshot().Generation, second.Generation)
+	assert.Equal(t, 11, lb.Snapshot().Backends[0].OldestBlock, "snapshot copies identify the live backend")
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy names accepted in the LB_STRATEGY settings.
+const (
+	StrategyWeighted         = "weighted"
+	StrategyRoundRobin       = "round-robin"
+	StrategyLeastOutstanding = "least-outstanding"
+	StrategyP2CEWMA          = "p2c-ewma"
+	StrategyConsistentHash   = "consistent-hash"
+)
+
+// Strategy picks one backend out of the eligible candidates of a request.
+// Pick is called concurrently, without lb.mu, with at least one candidate;
+// the candidates are immutable copies of the routing state. key identifies
+// the request for strategies that keep related requests together.
+type Strategy interface {
+	Name() string
+	Pick(candidates []*Backend, key string) *Backend
+}
+
+// NewStrategy returns the named strategy drawing randomness from rnd. A
+// *rand.Rand is not safe for concurrent use, so a seeded source is only meant
+// for reproducible tests; nil uses the global source.
+func NewStrategy(name string, rnd *rand.Rand) (Strategy, error) {
+	src := random{rnd: rnd}
+	switch name {
+	case StrategyWeighted, "":
+		return &weightedStrategy{rnd: src}, nil
+	case StrategyRoundRobin:
+		return &roundRobinStrategy{rnd: src}, nil
+	case StrategyLeastOutstanding:
+		return &leastOutstandingStrategy{rnd: src}, nil
+	case StrategyP2CEWMA:
+		return &p2cStrategy{rnd: src}, nil
+	case StrategyConsistentHash:
+		return &consistentHashStrategy{fallback: &weightedStrategy{rnd: src}}, nil
+	}
+	return nil, fmt.Errorf("unknown load balancing strategy %q", name)
+}
+
+// random draws from a seeded source, or from the global one when rnd is nil.
+type random struct {
+	rnd *rand.Rand
+}
+
+func (r random) Float64() float64 {
+	if r.rnd == nil {
+		return rand.Float64()
+	}
+	return r.rnd.Float64()
+}
+
+func (r random) Intn(n int) int {
+	if r.rnd == nil {
+		return rand.Intn(n)
+	}
+	return r.rnd.Intn(n)
+}
+
+// weightedStrategy picks randomly, weighted by integrity priority.
+type weightedStrategy struct {
+	rnd random
+}
+
+func (s *weightedStrategy) Name() string { return StrategyWeighted }
+
+func (s *weightedStrategy) Pick(candidates []*Backend, _ string) *Backend {
+	return pickWeighted(candidates, s.rnd.Float64)
+}
+
+// pickWeighted selects a backend with probability proportional to its
+// priority above the lowest candidate priority, scaled down while it is in
+// slow start.
+func pickWeighted(candidates []*Backend, random func() float64) *Backend {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	if candidates[0].IntegrityStats == nil {
+		return candidates[0] // Fallback
+	}
+	minPriority := candidates[0].IntegrityStats.Priority
+	for _, b := range candidates {
+		if b.IntegrityStats != nil && b.IntegrityStats.Priority < minPriority {
+			minPriority = b.IntegrityStats.Priority
+		}
+	}
+
+	var totalWeight float64
+	weights := make([]float64, len(candidates))
+	for i, b := range candidates {
+		// Weight calculation: distance from minPriority + base
+		prio := 100.0
+		if b.IntegrityStats != nil {
+			prio = b.IntegrityStats.Priority
+		}
+		w := math.Max(1, prio-minPriority+10) * b.slowStartShare()
+		weights[i] = w
+		totalWeight += w
+	}
+
+	r := random() * totalWeight
+
+	var cumulative float64
+	for i, w := range weights {
+		cumulative += w
+		if r < cumulative {
+			return candidates[i]
+		}
+	}
+
+	return candidates[0]
+}
+
+// roundRobinStrategy cycles through the candidates in pool order. A backend
+// in slow start takes its turn only with the probability of its ramp share
+// and passes it to the next candidate otherwise.
+type roundRobinStrategy struct {
+	next atomic.Uint64
+	rnd  random
+}
+
+func (s *roundRobinStrategy) Name() string { return StrategyRoundRobin }
+
+func (s *roundRobinStrategy) Pick(candidates []*Backend, _ string) *Backend {
+	n := s.next.Add(1) - 1
+	for i := range candidates {
+		b := candidates[(n+uint64(i))%uint64(len(candidates))]
+		if share := b.slowStartShare(); share >= 1 || s.rnd.Float64() < share {
+			return b
+		}
+	}
+	return candidates[n%uint64(len(candidates))]
+}
+
+// leastOutstandingStrategy picks the backend with the fewest requests in
+// flight, breaking ties randomly. A backend in slow start counts its requests,
+// including the new one, as if scaled up by its ramp share.
+type leastOutstandingStrategy struct {
+	rnd random
+}
+
+func (s *leastOutstandingStrategy) Name() string { return StrategyLeastOutstanding }
+
+func (s *leastOutstandingStrategy) Pick(candidates []*Backend, _ string) *Backend {
+	var (
+		best []*Backend
+		min  = math.Inf(1)
+	)
+	for _, b := range candidates {
+		switch n := float64(b.load.inFlight()+1) / b.slowStartShare(); {
+		case n < min:
+			min = n
+			best = append(best[:0], b)
+		case n == min:
+			best = append(best, b)
+		}
+	}
+	return best[s.rnd.Intn(len(best))]
+}
+
+// p2cStrategy compares two random candidates and picks the one with the lower
+// load cost: peak-EWMA latency scaled by the requests already in flight.
+// Backends without samples and nothing in flight win so they get measured.
+// A backend in slow start looks proportionally more expensive.
+type p2cStrategy struct {
+	rnd random
+}
+
+func (s *p2cStrategy) Name() string { return StrategyP2CEWMA }
+
+func (s *p2cStrategy) Pick(candidates []*Backend, _ string) *Backend {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	i := s.rnd.Intn(len(candidates))
+	j := s.rnd.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := candidates[i], candidates[j]
+	if p2cCost(b) < p2cCost(a) {
+		return b
+	}
+	return a
+}
+
+// p2cCost is the load cost of b, inflated while it is in slow start.
+func p2cCost(b *Backend) float64 {
+	return b.load.cost() / b.slowStartShare()
+}
+
+// consistentHashStrategy keeps requests with the same key on the same backend
+// using rendezvous hashing: only keys of a backend that leaves the pool move.
+// Scores are weighted by the slow start share, so a recovering backend wins
+// back its keys gradually. Requests without a key fall back to the weighted
+// pick.
+type consistentHashStrategy struct {
+	fallback Strategy
+}
+
+func (s *consistentHashStrategy) Name() string { return StrategyConsistentHash }
+
+func (s *consistentHashStrategy) Pick(candidates []*Backend, key string) *Backend {
+	if key == "" {
+		return s.fallback.Pick(candidates, key)
+	}
+	var (
+		best  *Backend
+		score float64
+	)
+	for _, b := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(b.URL))
+		if sc := rendezvousScore(h.Sum64(), b.slowStartShare()); best == nil || sc > score {
+			best, score = b, sc
+		}
+	}
+	return best
+}
+
+// rendezvousScore maps a hash to a weighted rendezvous score. With equal
+// weights the scores order backends like their hashes.
+func rendezvousScore(h uint64, weight float64) float64 {
+	u := (float64(h>>11) + 0.5) / (1 << 53) // Uniform in (0, 1)
+	return -weight / math.Log(u)
+}
+
+// defaultEWMADecay is the latency EWMA decay time when none is configured.
+const defaultEWMADecay = 10 * time.Second
+
+// unmeasuredPenalty is the latency assumed for a backend with requests in
+// flight but no completed sample yet.
+const unmeasuredPenalty = time.Second
+
+// backendLoad is the live request load of a backend: requests in flight and a
+// peak-EWMA of latency. Slower samples replace the average immediately, faster
+// ones pull it down with a weight that grows with the time since the previous
+// sample, so a slow backend sheds load at once and recovers over the decay
+// time. It is updated without lb.mu and safe to use on a nil receiver for
+// backends built in tests.
+type backendLoad struct {
+	active atomic.Int64
+	decay  time.Duration
+	now    func() time.Time // Clock for tests, time.Now when nil
+
+	mu    sync.Mutex
+	ewma  float64 // Nanoseconds, 0 before the first sample
+	stamp time.Time
+}
+
+func newBackendLoad(decay time.Duration) *backendLoad {
+	return &backendLoad{decay: decay}
+}
+
+func (l *backendLoad) inFlight() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.active.Load()
+}
+
+func (l *backendLoad) latency() time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Duration(l.ewma)
+}
+
+// cost estimates how long a new request would take on the backend.
+func (l *backendLoad) cost() float64 {
+	if l == nil {
+		return 0
+	}
+	active := float64(l.active.Load())
+	ewma := float64(l.latency())
+	if ewma == 0 {
+		return active * float64(unmeasuredPenalty)
+	}
+	return ewma * (active + 1)
+}
+
+func (l *backendLoad) begin() {
+	if l != nil {
+		l.active.Add(1)
+	}
+}
+
+func (l *backendLoad) end() {
+	if l != nil {
+		l.active.Add(-1)
+	}
+}
+
+func (l *backendLoad) observe(d time.Duration) {
+	if l == nil {
+		return
+	}
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+	decay := l.decay
+	if decay <= 0 {
+		decay = defaultEWMADecay
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sample := float64(d)
+	switch {
+	case l.stamp.IsZero(), sample > l.ewma:
+		l.ewma = sample
+	default:
+		w := math.Exp(-float64(now.Sub(l.stamp)) / float64(decay))
+		l.ewma = l.ewma*w + sample*(1-w)
+	}
+	l.stamp = now
+}
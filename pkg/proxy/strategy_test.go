@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func strategyBackends(urls ...string) []*Backend {
+	var out []*Backend
+	for _, url := range urls {
+		out = append(out, &Backend{URL: url, IntegrityStats: &IntegrityStats{Priority: 100}, load: &backendLoad{}})
+	}
+	return out
+}
+
+func seeded() *rand.Rand {
+	return rand.New(rand.NewSource(42))
+}
+
+func pickCounts(s Strategy, candidates []*Backend, key string, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[s.Pick(candidates, key).URL]++
+	}
+	return counts
+}
+
+func TestWeightedStrategy_Deterministic(t *testing.T) {
+	candidates := strategyBackends("a", "b", "c")
+	candidates[1].IntegrityStats.Priority = 140
+
+	first := pickCounts(&weightedStrategy{rnd: random{seeded()}}, candidates, "", 1000)
+	second := pickCounts(&weightedStrategy{rnd: random{seeded()}}, candidates, "", 1000)
+
+	assert.Equal(t, first, second, "the same seed gives the same picks")
+	assert.Greater(t, first["b"], first["a"])
+	assert.Greater(t, first["b"], first["c"])
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+	candidates := strategyBackends("a", "b", "c")
+	s := &roundRobinStrategy{}
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, s.Pick(candidates, "").URL)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, got)
+}
+
+func TestLeastOutstandingStrategy(t *testing.T) {
+	candidates := strategyBackends("a", "b", "c")
+	candidates[0].load.active.Store(3)
+	candidates[1].load.active.Store(1)
+	candidates[2].load.active.Store(1)
+
+	counts := pickCounts(&leastOutstandingStrategy{rnd: random{seeded()}}, candidates, "", 100)
+
+	assert.Zero(t, counts["a"])
+	assert.Greater(t, counts["b"], 0, "ties are broken randomly")
+	assert.Greater(t, counts["c"], 0)
+}
+
+func TestP2CStrategy(t *testing.T) {
+	candidates := strategyBackends("fast", "slow")
+	candidates[0].load.observe(10 * time.Millisecond)
+	candidates[1].load.observe(200 * time.Millisecond)
+
+	counts := pickCounts(&p2cStrategy{rnd: random{seeded()}}, candidates, "", 100)
+	assert.Equal(t, 100, counts["fast"], "with two candidates the faster one always wins")
+
+	candidates = strategyBackends("a", "b", "c")
+	candidates[0].load.observe(time.Millisecond)
+	counts = pickCounts(&p2cStrategy{rnd: random{seeded()}}, candidates, "", 300)
+	assert.Greater(t, counts["b"]+counts["c"], 0, "backends without samples get picked")
+}
+
+func TestConsistentHashStrategy(t *testing.T) {
+	s, err := NewStrategy(StrategyConsistentHash, seeded())
+	assert.NoError(t, err)
+	candidates := strategyBackends("a", "b", "c", "d")
+
+	owners := make(map[string]string)
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8"} {
+		owners[key] = s.Pick(candidates, key).URL
+		assert.Equal(t, owners[key], s.Pick(candidates, key).URL, "same key, same backend")
+	}
+
+	// Removing a backend only moves the keys it owned
+	var remaining []*Backend
+	for _, b := range candidates {
+		if b.URL != "a" {
+			remaining = append(remaining, b)
+		}
+	}
+	for key, owner := range owners {
+		if owner != "a" {
+			assert.Equal(t, owner, s.Pick(remaining, key).URL)
+		}
+	}
+}
+
+func TestNewStrategy_Unknown(t *testing.T) {
+	_, err := NewStrategy("fastest", seeded())
+	assert.Error(t, err)
+}
+
+func TestLoadBalancer_StrategyPerRoute(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends:   []string{"http://node1", "http://node2"},
+		LBStrategy:         StrategyWeighted,
+		LBStrategyArchiver: StrategyRoundRobin,
+	}
+	lb := NewLoadBalancer(cfg)
+
+	assert.Equal(t, StrategyWeighted, lb.strategies[""].Name())
+	assert.Equal(t, StrategyRoundRobin, lb.strategies["archiver"].Name())
+	assert.Equal(t, StrategyWeighted, lb.strategies["pruned"].Name(), "routes without a setting inherit LB_STRATEGY")
+
+	lb.SetStrategy("", &roundRobinStrategy{})
+	assert.Equal(t, "http://node1", lb.Select(Criteria{}).URL)
+	assert.Equal(t, "http://node2", lb.Select(Criteria{}).URL)
+}
+
+func TestBackendLoad_PeakEWMA(t *testing.T) {
+	now := time.Now()
+	l := newBackendLoad(10 * time.Second)
+	l.now = func() time.Time { return now }
+
+	l.observe(10 * time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, l.latency())
+
+	l.observe(500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, l.latency(), "slowdowns are taken at their peak")
+
+	now = now.Add(100 * time.Millisecond)
+	l.observe(10 * time.Millisecond)
+	assert.Greater(t, l.latency(), 400*time.Millisecond, "a fast sample right after barely moves the average")
+
+	now = now.Add(30 * time.Second)
+	l.observe(10 * time.Millisecond)
+	assert.Less(t, l.latency(), 40*time.Millisecond, "after several decay times the average has recovered")
+}
+
+func TestBackendLoad_CostCountsInFlight(t *testing.T) {
+	l := newBackendLoad(0)
+	assert.Zero(t, l.cost())
+
+	l.begin()
+	assert.Equal(t, float64(unmeasuredPenalty), l.cost(), "unmeasured but busy backends are not free")
+
+	l.observe(10 * time.Millisecond)
+	l.begin()
+	assert.Equal(t, float64(30*time.Millisecond), l.cost())
+	l.end()
+	l.end()
+	assert.Equal(t, float64(10*time.Millisecond), l.cost())
+}
+
+func TestP2CStrategy_ShedsLoadFromBusyBackend(t *testing.T) {
+	candidates := strategyBackends("a", "b")
+	candidates[0].load.observe(20 * time.Millisecond)
+	candidates[1].load.observe(20 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		candidates[0].load.begin() // a is stuck on slow requests
+	}
+
+	counts := pickCounts(&p2cStrategy{rnd: random{seeded()}}, candidates, "", 50)
+	assert.Equal(t, 50, counts["b"])
+}
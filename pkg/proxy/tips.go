@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"time"
+)
+
+// ChainTips is the pool-wide view of the L2 chain tips.
+type ChainTips struct {
+	Latest     int       `json:"latest"`
+	LatestHash string    `json:"latestHash"`
+	Proven     int       `json:"proven"`
+	Finalized  int       `json:"finalized"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// ChainTipsListener is notified when the pool's chain tips change.
+type ChainTipsListener func(prev, next ChainTips, reorg bool)
+
+// ChainTips returns the latest pool-wide chain tips. The zero value means
+// no tips have been observed yet.
+func (lb *LoadBalancer) ChainTips() ChainTips {
+	return lb.current().tips
+}
+
+// OnChainTips registers a listener called after every tips change.
+func (lb *LoadBalancer) OnChainTips(fn ChainTipsListener) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.tipsListeners = append(lb.tipsListeners, fn)
+}
+
+// UpdateChainTips stores new pool-wide tips and notifies listeners when they
+// moved or a reorg was detected.
+func (lb *LoadBalancer) UpdateChainTips(next ChainTips, reorg bool) {
+	lb.mu.Lock()
+	prev := lb.tips
+	next.UpdatedAt = time.Now()
+	lb.tips = next
+	lb.publish()
+	listeners := lb.tipsListeners
+	lb.mu.Unlock()
+
+	moved := prev.Latest != next.Latest || prev.LatestHash != next.LatestHash ||
+		prev.Proven != next.Proven || prev.Finalized != next.Finalized
+	if !moved && !reorg {
+		return
+	}
+	for _, fn := range listeners {
+		fn(prev, next, reorg)
+	}
+}
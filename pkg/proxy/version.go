@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Version policies select which node version the pool routes to while
+// versions are mixed, e.g. during a network upgrade.
+const (
+	VersionPolicyAny      = "any"      // Route to every version
+	VersionPolicyPin      = "pin"      // Route only to VERSION_PIN
+	VersionPolicyMajority = "majority" // Route to the version most healthy backends run
+)
+
+// TargetVersion returns the node version the pool currently routes to, or ""
+// when every version is eligible.
+func (lb *LoadBalancer) TargetVersion() string {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.targetVersion
+}
+
+// recomputeVersions applies the version policy, flagging backends that run a
+// different node version than the target. Backends whose version is not known
+// yet are not flagged. Caller holds lb.mu.
+func (lb *LoadBalancer) recomputeVersions() {
+	counts := make(map[string]int)
+	for _, b := range lb.backends {
+		if b.Healthy && b.NodeVersion != "" {
+			counts[b.NodeVersion]++
+		}
+	}
+
+	target := ""
+	switch lb.cfg.VersionPolicy {
+	case VersionPolicyPin:
+		target = lb.cfg.VersionPin
+	case VersionPolicyMajority:
+		target = majorityVersion(counts)
+	}
+	if target != lb.targetVersion {
+		log.Info().Str("policy", lb.cfg.VersionPolicy).Str("from", lb.targetVersion).Str("to", target).Msg("Target node version changed")
+		lb.targetVersion = target
+	}
+
+	for _, b := range lb.backends {
+		mismatch := target != "" && b.NodeVersion != "" && b.NodeVersion != target
+		if mismatch && !b.VersionMismatch {
+			log.Warn().Str("url", b.URL).Str("version", b.NodeVersion).Str("target", target).Msg("Backend excluded: node version mismatch")
+		}
+		b.VersionMismatch = mismatch
+		metrics.SetBackendVersionMismatch(b.URL, mismatch)
+	}
+	metrics.SetNodeVersions(counts)
+}
+
+// majorityVersion returns the most common version; ties go to the greater
+// version so the pool moves forward during an upgrade.
+func majorityVersion(counts map[string]int) string {
+	best := ""
+	for v, n := range counts {
+		if n > counts[best] || (n == counts[best] && compareVersions(v, best) > 0) {
+			best = v
+		}
+	}
+	return best
+}
+
+// compareVersions orders two node versions, returning -1, 0 or 1. Semantic
+// versions, with or without a "v" prefix, compare by precedence and rank
+// above anything else. Other strings, and versions of equal precedence such
+// as "1.0.0" and "v1.0.0", compare lexically so distinct versions never tie.
+func compareVersions(a, b string) int {
+	sa, okA := parseSemver(a)
+	sb, okB := parseSemver(b)
+	switch {
+	case okA && okB:
+		for i := range sa.core {
+			if c := cmp.Compare(sa.core[i], sb.core[i]); c != 0 {
+				return c
+			}
+		}
+		if c := comparePrerelease(sa.pre, sb.pre); c != 0 {
+			return c
+		}
+	case okA:
+		return 1
+	case okB:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+type semver struct {
+	core [3]int
+	pre  []string // Pre-release identifiers, nil for a release
+}
+
+// parseSemver parses MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD].
+func parseSemver(v string) (semver, bool) {
+	var s semver
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, hasPre := strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return s, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || p[0] == '+' {
+			return s, false
+		}
+		s.core[i] = n
+	}
+	if hasPre {
+		if pre == "" {
+			return s, false
+		}
+		s.pre = strings.Split(pre, ".")
+	}
+	return s, true
+}
+
+// comparePrerelease orders pre-release identifiers: a release ranks above any
+// pre-release, numeric identifiers compare numerically and below alphanumeric
+// ones, and a longer list wins when all shared identifiers are equal.
+func comparePrerelease(a, b []string) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		na, errA := strconv.Atoi(a[i])
+		nb, errB := strconv.Atoi(b[i])
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = cmp.Compare(na, nb)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// versionPool builds a pool with one backend per node version.
+func versionPool(policy, pin string, versions ...string) *LoadBalancer {
+	lb := testPool(len(versions), func(cfg *config.Config) {
+		cfg.VersionPolicy = policy
+		cfg.VersionPin = pin
+	})
+	for i, v := range versions {
+		lb.UpdateBackendStateByUrl(lb.backends[i].URL, func(b *Backend) { b.NodeVersion = v })
+	}
+	return lb
+}
+
+func TestVersionPolicy_Majority(t *testing.T) {
+	lb := versionPool(VersionPolicyMajority, "", "1.0.0", "1.1.0", "1.1.0")
+
+	assert.Equal(t, "1.1.0", lb.TargetVersion())
+	for i := 0; i < 20; i++ {
+		assert.NotEqual(t, "http://node1", lb.Select(Criteria{}).URL)
+	}
+	assert.True(t, lb.backends[0].VersionMismatch)
+
+	// Header override routes to the minority version
+	assert.Equal(t, "http://node1", lb.Select(Criteria{NodeVersion: "1.0.0"}).URL)
+}
+
+func TestMajorityVersion_TiesGoToNewerSemver(t *testing.T) {
+	assert.Equal(t, "0.10.0", majorityVersion(map[string]int{"0.9.0": 2, "0.10.0": 2}))
+	assert.Equal(t, "v2.0.0", majorityVersion(map[string]int{"v2.0.0": 1, "1.9.9": 1}))
+	assert.Equal(t, "1.0.0", majorityVersion(map[string]int{"1.0.0-rc.10": 1, "1.0.0": 1}))
+	assert.Equal(t, "0.9.0", majorityVersion(map[string]int{"0.9.0": 3, "0.10.0": 2}), "a majority still wins")
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "v1.2.3", -1}, // Equal precedence: lexical, so distinct versions never tie
+		{"1.10.0", "1.9.0", 1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-1", "1.0.0-alpha", -1},
+		{"1.0.0+build.5", "1.0.0", 1},
+		{"1.0.0", "nightly", 1},
+		{"abc", "abd", -1},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, compareVersions(tc.a, tc.b), "%s vs %s", tc.a, tc.b)
+		assert.Equal(t, -tc.want, compareVersions(tc.b, tc.a), "%s vs %s", tc.b, tc.a)
+	}
+}
+
+func TestVersionPolicy_Pin(t *testing.T) {
+	lb := versionPool(VersionPolicyPin, "1.0.0", "1.0.0", "1.1.0", "1.1.0")
+
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "http://node1", lb.Select(Criteria{}).URL)
+	}
+}
+
+func TestVersionPolicy_AnyAndUnknown(t *testing.T) {
+	lb := versionPool(VersionPolicyAny, "", "1.0.0", "1.1.0")
+	assert.Equal(t, "", lb.TargetVersion())
+	assert.False(t, lb.backends[0].VersionMismatch)
+
+	lb = versionPool(VersionPolicyMajority, "", "1.1.0", "")
+	assert.False(t, lb.backends[1].VersionMismatch, "backends not probed yet stay eligible")
+}
+
+func TestForwarder_NodeVersionHeader(t *testing.T) {
+	f, lb, hits := livePool(t, 1)
+	lb.UpdateBackendStateByUrl(lb.backends[0].URL, func(b *Backend) { b.NodeVersion = "1.0.0" })
+
+	w := httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{HeaderNodeVersion: "2.0.0"}))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "2.0.0")
+
+	w = httptest.NewRecorder()
+	f.Forward(w, freshRequest(map[string]string{HeaderNodeVersion: "1.0.0"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits[0]))
+}
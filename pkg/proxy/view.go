@@ -0,0 +1,91 @@
+package proxy
+
+import "time"
+
+// poolView is an immutable copy of the routing state of the pool. Writers
+// rebuild it under lb.mu after every change and swap it in atomically, so
+// Select and the other per-request reads never take lb.mu.
+type poolView struct {
+	pools      map[string][]*Backend // Healthy, non-lagging backends per node type ("" for all)
+	byURL      map[string]*Backend
+	strategies map[string]Strategy
+	bestBlock  int
+	tips       ChainTips
+}
+
+// publish swaps in a view of the current pool state. Caller holds lb.mu.
+func (lb *LoadBalancer) publish() {
+	v := &poolView{
+		pools:      make(map[string][]*Backend),
+		byURL:      make(map[string]*Backend, len(lb.backends)),
+		strategies: make(map[string]Strategy, len(lb.strategies)),
+		bestBlock:  lb.bestBlock,
+		tips:       lb.tips,
+	}
+	for nodeType, s := range lb.strategies {
+		v.strategies[nodeType] = s
+	}
+	for _, b := range lb.backends {
+		c := b.routingCopy()
+		v.byURL[b.URL] = c
+		if !c.Healthy || c.Lagging {
+			continue
+		}
+		v.pools[""] = append(v.pools[""], c)
+		if c.NodeType != "" {
+			v.pools[c.NodeType] = append(v.pools[c.NodeType], c)
+		}
+	}
+	lb.generation++
+	lb.view.Store(v)
+}
+
+// current returns the latest view, building the first one for load balancers
+// not created through NewLoadBalancer.
+func (lb *LoadBalancer) current() *poolView {
+	if v := lb.view.Load(); v != nil {
+		return v
+	}
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if lb.view.Load() == nil {
+		lb.publish()
+	}
+	return lb.view.Load()
+}
+
+// routingCopy returns a copy of the fields selection reads. The live load,
+// breaker, slow start ramp and request stats are shared: they are safe for
+// concurrent use. Caller holds lb.mu.
+func (b *Backend) routingCopy() *Backend {
+	c := *b
+	c.origin = b
+	if b.IntegrityStats != nil {
+		is := *b.IntegrityStats
+		c.IntegrityStats = &is
+	}
+	if b.EpochStats != nil {
+		es := *b.EpochStats
+		c.EpochStats = &es
+	}
+	return &c
+}
+
+// live returns the backend a routing copy was taken from.
+func (b *Backend) live() *Backend {
+	if b.origin != nil {
+		return b.origin
+	}
+	return b
+}
+
+// candidates returns the backends of the view eligible for c.
+func (lb *LoadBalancer) candidates(v *poolView, c Criteria, now time.Time) []*Backend {
+	var candidates []*Backend
+	for _, b := range v.pools[c.NodeType] {
+		if lb.eligible(b, c, now) {
+			candidates = append(candidates, b)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect_ReturnsLiveBackend(t *testing.T) {
+	lb := testPool(1)
+
+	b := lb.Select(Criteria{})
+	assert.Same(t, lb.backends[0], b)
+
+	lb.IncSuccessfulRequest(b, 200, time.Millisecond)
+	assert.Equal(t, int64(1), lb.backends[0].RequestStats.TotalRequests)
+}
+
+func TestSelect_SeesPublishedChanges(t *testing.T) {
+	lb := testPool(2)
+
+	lb.UpdateBackendStateByUrl("http://node1", func(b *Backend) { b.Healthy = false })
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "http://node2", lb.Select(Criteria{}).URL)
+	}
+
+	lb.MarkMethodUnsupported(lb.backends[1], "node_getBlock")
+	assert.Nil(t, lb.Select(Criteria{Method: "node_getBlock"}))
+}
+
+func TestSelect_ConcurrentWithUpdates(t *testing.T) {
+	lb := testPool(4)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			lb.UpdateBackendHealth(fmt.Sprintf("http://node%d", i%4+1), true, i, time.Millisecond)
+			lb.UpdateIntegrityScore("http://node1", 90, nil, nil)
+		}
+	}()
+
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				if b := lb.Select(Criteria{}); assert.NotNil(t, b) {
+					lb.IncSuccessfulRequest(b, 200, time.Millisecond)
+					lb.RecordMethodLatency("node_getBlock", time.Millisecond)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+// BenchmarkSelect measures the per-request work of the load balancer the way
+// live traffic does it: selection, in-flight accounting, and recording the
+// outcome and latency per backend and per method.
+func BenchmarkSelect(b *testing.B) {
+	lb := testPool(8)
+	for _, be := range lb.backends {
+		lb.UpdateBackendHealth(be.URL, true, 100, time.Millisecond)
+	}
+	methods := []string{"node_getBlock", "node_getBlockNumber", "node_getTxReceipt", "node_getL2Tips"}
+	for _, m := range methods {
+		metrics.LearnMethod(m)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			method := methods[i%len(methods)]
+			latency := time.Duration(1+i%50) * time.Millisecond
+			be := lb.Select(Criteria{Method: method})
+			be.load.begin()
+			lb.IncSuccessfulRequest(be, 200, latency)
+			lb.RecordMethodLatency(method, latency)
+			be.load.end()
+		}
+	})
+}
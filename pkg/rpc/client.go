@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -34,6 +35,19 @@ type JSONRPCError struct {
 	Message string `json:"message"`
 }
 
+// CodeMethodNotFound is the JSON-RPC error code for unknown methods.
+const CodeMethodNotFound = -32601
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("rpc error: %s (code %d)", e.Message, e.Code)
+}
+
+// IsMethodNotFound reports whether err is a JSON-RPC "method not found" error.
+func IsMethodNotFound(err error) bool {
+	var rpcErr *JSONRPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == CodeMethodNotFound
+}
+
 func NewClient(url string, timeout time.Duration) *Client {
 	return &Client{
 		url: url,
@@ -71,17 +85,21 @@ func (c *Client) Call(ctx context.Context, method string, params ...interface{})
 	}
 	defer resp.Body.Close()
 
+	var rpcResp JSONRPCResponse
 	if resp.StatusCode != http.StatusOK {
+		// Some nodes answer JSON-RPC errors such as "method not found" with a 4xx status
+		if json.NewDecoder(resp.Body).Decode(&rpcResp) == nil && rpcResp.Error != nil {
+			return nil, rpcResp.Error
+		}
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	var rpcResp JSONRPCResponse
 	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
 
 	if rpcResp.Error != nil {
-		return nil, fmt.Errorf("rpc error: %s (code %d)", rpcResp.Error.Message, rpcResp.Error.Code)
+		return nil, rpcResp.Error
 	}
 
 	return rpcResp.Result, nil
@@ -101,6 +119,46 @@ func (c *Client) GetValidatorsStats(ctx context.Context) (*GetValidatorsStatsRes
 	return &stats, nil
 }
 
+func (c *Client) GetL2Tips(ctx context.Context) (*L2Tips, error) {
+	res, err := c.Call(ctx, "node_getL2Tips")
+	if err != nil {
+		return nil, err
+	}
+
+	var tips L2Tips
+	if err := json.Unmarshal(res, &tips); err != nil {
+		return nil, fmt.Errorf("unmarshal tips: %w", err)
+	}
+
+	return &tips, nil
+}
+
+// GetNodeVersion returns the node software version (node_getNodeVersion).
+func (c *Client) GetNodeVersion(ctx context.Context) (string, error) {
+	res, err := c.Call(ctx, "node_getNodeVersion")
+	if err != nil {
+		return "", err
+	}
+	var version string
+	if err := json.Unmarshal(res, &version); err != nil {
+		return "", fmt.Errorf("unmarshal nodeVersion: %w", err)
+	}
+	return version, nil
+}
+
+// GetProtocolVersion returns the rollup protocol version (node_getVersion).
+func (c *Client) GetProtocolVersion(ctx context.Context) (int, error) {
+	res, err := c.Call(ctx, "node_getVersion")
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	if err := json.Unmarshal(res, &version); err != nil {
+		return 0, fmt.Errorf("unmarshal version: %w", err)
+	}
+	return version, nil
+}
+
 func (c *Client) IsReady(ctx context.Context) (bool, error) {
 	res, err := c.Call(ctx, "node_isReady")
 	if err != nil {
@@ -137,3 +195,14 @@ func (c *Client) GetBlockNumber(ctx context.Context) (int, error) {
 
 	return 0, fmt.Errorf("unmarshal blockNum failed")
 }
+
+// HasBlock reports whether the node still serves block n (node_getBlockHeader
+// answers null for blocks it has pruned or not produced yet).
+func (c *Client) HasBlock(ctx context.Context, n int) (bool, error) {
+	res, err := c.Call(ctx, "node_getBlockHeader", n)
+	if err != nil {
+		return false, err
+	}
+	trimmed := bytes.TrimSpace(res)
+	return len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")), nil
+}
@@ -1,9 +1,17 @@
 package rpc
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+)
 
 type RPCClient interface {
+	Call(ctx context.Context, method string, params ...interface{}) (json.RawMessage, error)
 	IsReady(ctx context.Context) (bool, error)
 	GetBlockNumber(ctx context.Context) (int, error)
+	HasBlock(ctx context.Context, n int) (bool, error)
 	GetValidatorsStats(ctx context.Context) (*GetValidatorsStatsResponse, error)
+	GetL2Tips(ctx context.Context) (*L2Tips, error)
+	GetNodeVersion(ctx context.Context) (string, error)
+	GetProtocolVersion(ctx context.Context) (int, error)
 }
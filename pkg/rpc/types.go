@@ -13,3 +13,15 @@ type ValidatorHistoryItem struct {
 	Slot   string `json:"slot"`
 	Status string `json:"status"`
 }
+
+// L2Tips is the response of node_getL2Tips.
+type L2Tips struct {
+	Latest    L2BlockId `json:"latest"`
+	Proven    L2BlockId `json:"proven"`
+	Finalized L2BlockId `json:"finalized"`
+}
+
+type L2BlockId struct {
+	Number int    `json:"number"`
+	Hash   string `json:"hash"`
+}
@@ -104,7 +104,7 @@ func (s *Server) setupRoutes() {
 }
 
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
-	if len(s.lb.GetBackends()) > 0 {
+	if len(s.lb.Snapshot().Backends) > 0 {
 		w.Write([]byte("READY"))
 	} else {
 		http.Error(w, "Not Ready", http.StatusServiceUnavailable)
@@ -112,7 +112,8 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	backends := s.lb.GetBackends()
+	snap := s.lb.Snapshot()
+	backends := snap.Backends
 	healthyCount := 0
 	for _, b := range backends {
 		if b.Healthy {
@@ -140,9 +141,14 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 
 	response := map[string]interface{}{
-		"status":   status,
-		"uptime":   time.Since(s.startTime).Seconds(),
-		"backends": backends,
+		"status":        status,
+		"uptime":        time.Since(s.startTime).Seconds(),
+		"generation":    snap.Generation,
+		"backends":      backends,
+		"bestBlock":     snap.BestBlock,
+		"chainTips":     snap.ChainTips,
+		"targetVersion": snap.TargetVersion,
+		"methods":       snap.Methods,
 		"metrics": map[string]interface{}{
 			"totalRequests": totalRequests,
 			"totalErrors":   totalErrors,
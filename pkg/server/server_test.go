@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DashNode-Org/sentinel-proxy/config"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/metrics"
+	"github.com/DashNode-Org/sentinel-proxy/pkg/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_HandleHealth(t *testing.T) {
+	cfg := &config.Config{
+		SentinelBackends: []string{"http://node1", "http://node2"},
+		VersionPolicy:    proxy.VersionPolicyMajority,
+	}
+	lb := proxy.NewLoadBalancer(cfg)
+	for _, url := range cfg.SentinelBackends {
+		lb.UpdateBackendStateByUrl(url, func(b *proxy.Backend) { b.NodeVersion = "1.2.0" })
+	}
+	lb.UpdateBackendHealth("http://node1", true, 120, time.Millisecond)
+	lb.UpdateChainTips(proxy.ChainTips{Latest: 120, LatestHash: "0xa", Proven: 110, Finalized: 100}, false)
+	metrics.LearnMethod("node_getBlockNumber")
+	lb.RecordMethodLatency("node_getBlockNumber", 5*time.Millisecond)
+	node1 := lb.Select(proxy.Criteria{Exclude: map[string]bool{"http://node2": true}})
+	node2 := lb.Select(proxy.Criteria{Exclude: map[string]bool{"http://node1": true}})
+	lb.IncSuccessfulRequest(node1, http.StatusOK, time.Millisecond)
+	lb.IncSuccessfulRequest(node1, http.StatusOK, time.Millisecond)
+	lb.IncSuccessfulRequest(node1, http.StatusOK, time.Millisecond)
+	lb.IncErrorRequest(node2)
+
+	s := NewServer(cfg, lb, proxy.NewRequestForwarder(cfg, lb))
+	w := httptest.NewRecorder()
+	s.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var body struct {
+		Status        string                         `json:"status"`
+		Generation    uint64                         `json:"generation"`
+		Backends      []map[string]interface{}       `json:"backends"`
+		BestBlock     int                            `json:"bestBlock"`
+		ChainTips     proxy.ChainTips                `json:"chainTips"`
+		TargetVersion string                         `json:"targetVersion"`
+		Methods       map[string]*proxy.RequestStats `json:"methods"`
+		Metrics       map[string]float64             `json:"metrics"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+	assert.Equal(t, "healthy", body.Status)
+	assert.Equal(t, lb.Snapshot().Generation, body.Generation)
+	assert.Len(t, body.Backends, 2)
+	assert.Equal(t, 120, body.BestBlock)
+	assert.Equal(t, 120, body.ChainTips.Latest)
+	assert.Equal(t, "0xa", body.ChainTips.LatestHash)
+	assert.Equal(t, 110, body.ChainTips.Proven)
+	assert.Equal(t, 100, body.ChainTips.Finalized)
+	assert.Equal(t, "1.2.0", body.TargetVersion)
+	if assert.Contains(t, body.Methods, "node_getBlockNumber") {
+		assert.Equal(t, int64(1), body.Methods["node_getBlockNumber"].TotalRequests)
+	}
+	assert.Equal(t, 4.0, body.Metrics["totalRequests"])
+	assert.Equal(t, 1.0, body.Metrics["totalErrors"])
+	assert.Equal(t, 0.25, body.Metrics["errorRate"])
+}
+
+func TestServer_HandleHealthUnhealthyPool(t *testing.T) {
+	cfg := &config.Config{SentinelBackends: []string{"http://node1"}}
+	lb := proxy.NewLoadBalancer(cfg)
+	lb.UpdateBackendHealth("http://node1", false, 0, 0)
+
+	s := NewServer(cfg, lb, proxy.NewRequestForwarder(cfg, lb))
+	w := httptest.NewRecorder()
+	s.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "unhealthy", body["status"])
+	assert.Equal(t, "", body["targetVersion"], "no version is targeted before any is known")
+	assert.Equal(t, 0.0, body["metrics"].(map[string]interface{})["errorRate"])
+}